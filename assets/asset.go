@@ -5,6 +5,7 @@ import (
 	"image/color"
 	"image/jpeg"
 	"os"
+	"sync"
 
 	"github.com/fogleman/gg"
 	"github.com/golang/freetype/truetype"
@@ -13,7 +14,19 @@ import (
 //go:embed Roboto-Regular.ttf
 var FontBytes []byte
 
-var Font *truetype.Font
+var (
+	Font     *truetype.Font
+	fontErr  error
+	fontOnce sync.Once
+)
+
+// LoadFont parses the embedded font once, it is safe for concurrent use
+func LoadFont() (*truetype.Font, error) {
+	fontOnce.Do(func() {
+		Font, fontErr = truetype.Parse(FontBytes)
+	})
+	return Font, fontErr
+}
 
 func CreateImage(
 	width, height int,
@@ -25,14 +38,11 @@ func CreateImage(
 	dc.DrawRectangle(0, 0, float64(width), float64(height))
 	dc.Fill()
 
-	if Font == nil {
-		var err error
-		Font, err = truetype.Parse(FontBytes)
-		if err != nil {
-			return err
-		}
+	font, err := LoadFont()
+	if err != nil {
+		return err
 	}
-	dc.SetFontFace(truetype.NewFace(Font, &truetype.Options{Size: fontSize}))
+	dc.SetFontFace(truetype.NewFace(font, &truetype.Options{Size: fontSize}))
 
 	dc.SetColor(color.RGBA{R: 255, G: 255, B: 255, A: 255})
 	dc.DrawStringAnchored(text, float64(width/2), float64(height/2), 0.5, 0.5)
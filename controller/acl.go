@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const aclContextKey = "goview.acl"
+
+// aclOf returns the ACL of current user, requests without user come from routes without auth and can do anything
+func aclOf(context *gin.Context, db *gorm.DB) (*model.ACL, error) {
+	if acl, ok := context.Get(aclContextKey); ok {
+		return acl.(*model.ACL), nil
+	}
+
+	// db may be a query in progress, e.g. in WillGetAll
+	db = db.Session(&gorm.Session{NewDB: true})
+
+	acl := &model.ACL{}
+
+	user := CurrentUser(context)
+	if user == nil || user.Admin {
+		acl.Admin = true
+	} else {
+		err := db.Where(
+			"`deleted_at` IS NULL AND (`user_id` = ? OR `group_id` IN (?))",
+			user.ID,
+			db.Model(&model.GroupMember{}).Select("group_id").Where("`user_id` = ? AND `deleted_at` IS NULL", user.ID),
+		).Find(&acl.Permissions).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if token := CurrentApiToken(context); token != nil {
+		acl.Scope = token.Actions()
+	}
+
+	context.Set(aclContextKey, acl)
+
+	return acl, nil
+}
+
+// can reports whether current user can do action on file, without responding
+func can(context *gin.Context, db *gorm.DB, datasourceID gocrud.ID, file string, action model.Action) bool {
+	acl, err := aclOf(context, db)
+	if err != nil {
+		l.Error().Printf("Failed to load acl: %v", err)
+		return false
+	}
+	return acl.Can(datasourceID, file, action)
+}
+
+// authorize responds with forbidden if current user can not do action on file
+func authorize(context *gin.Context, db *gorm.DB, datasourceID gocrud.ID, file string, action model.Action) bool {
+	if can(context, db, datasourceID, file, action) {
+		return true
+	}
+	gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "permission denied")
+	return false
+}
+
+// canKey is can for a preview key
+func canKey(context *gin.Context, db *gorm.DB, key model.FileKey, action model.Action) bool {
+	id, file := model.FileKey(strings.TrimPrefix(strings.TrimSpace(string(key)), "/")).Split()
+	if id == 0 {
+		return false
+	}
+	return can(context, db, id, file, action)
+}
+
+// scopePreviews limits a preview query to the paths current user can read
+func scopePreviews(context *gin.Context, db *gorm.DB) *gorm.DB {
+	acl, err := aclOf(context, db)
+	if err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+		return db
+	} else if acl.Admin && acl.Allows(model.ActionRead) {
+		return db
+	}
+
+	readable := acl.Readable()
+	if len(readable) == 0 {
+		return db.Where("1 = 0")
+	}
+
+	base := db.Session(&gorm.Session{NewDB: true})
+
+	var scope *gorm.DB
+	for _, permission := range readable {
+		prefix := string(permission.KeyPrefix())
+		condition := base.Where(
+			"`datasource_id` = ? AND (`key` = ? OR `key` LIKE ? ESCAPE '!')",
+			permission.DatasourceID, prefix, escapeLike(prefix)+"/%",
+		)
+		if scope == nil {
+			scope = condition
+		} else {
+			scope = scope.Or(condition)
+		}
+	}
+
+	return db.Where(scope)
+}
+
+// escapeLike escapes s for LIKE ... ESCAPE '!', backslash is not portable between mysql and sqlite
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func SetupGroupController(group *gin.RouterGroup, db *gorm.DB) error {
+	return gocrud.New(group, db, gocrud.Crud[model.Group]{
+		EnableGetAll: true,
+		SearchHandlers: map[string]gocrud.SearchHandler{
+			"name":    gocrud.KeywordLike("name", nil),
+			"deleted": gocrud.NewSoftDeleteSearchHandler(""),
+		},
+		OnDelete: gocrud.NewSoftDeleteHandler[model.Group](gocrud.RestCoder),
+	})
+}
+
+func SetupGroupMemberController(group *gin.RouterGroup, db *gorm.DB) error {
+	return gocrud.New(group, db, gocrud.Crud[model.GroupMember]{
+		EnableGetAll: true,
+		SearchHandlers: map[string]gocrud.SearchHandler{
+			"groupId": gocrud.KeywordEqual("group_id", nil),
+			"userId":  gocrud.KeywordEqual("user_id", nil),
+			"deleted": gocrud.NewSoftDeleteSearchHandler(""),
+		},
+		OnDelete: gocrud.NewSoftDeleteHandler[model.GroupMember](gocrud.RestCoder),
+	})
+}
+
+func SetupPermissionController(group *gin.RouterGroup, db *gorm.DB) error {
+	return gocrud.New(group, db, gocrud.Crud[model.Permission]{
+		EnableGetAll: true,
+		SearchHandlers: map[string]gocrud.SearchHandler{
+			"datasourceId": gocrud.KeywordEqual("datasource_id", nil),
+			"groupId":      gocrud.KeywordEqual("group_id", nil),
+			"userId":       gocrud.KeywordEqual("user_id", nil),
+			"deleted":      gocrud.NewSoftDeleteSearchHandler(""),
+		},
+		WillSave: func(record *model.Permission, context *gin.Context, db *gorm.DB) {
+			if (record.UserID == 0) == (record.GroupID == 0) {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "exactly one of user and group is required")
+				return
+			}
+
+			file, err := model.CleanPath(record.Path)
+			if err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+				return
+			}
+			record.Path = file
+		},
+		DidSave: func(record *model.Permission, context *gin.Context, db *gorm.DB) {
+			audit(context, db, model.AuditEvent{
+				Action:       model.AuditPermissionSave,
+				DatasourceID: record.DatasourceID,
+				Path:         record.Path,
+				Detail:       fmt.Sprintf("user %d, group %d, actions %d", record.UserID, record.GroupID, record.Actions),
+			})
+		},
+		OnDelete: gocrud.NewSoftDeleteHandler[model.Permission](gocrud.RestCoder),
+		DidDelete: func(context *gin.Context, db *gorm.DB) {
+			audit(context, db, model.AuditEvent{
+				Action: model.AuditPermissionDelete,
+				Detail: context.Param("id"),
+			})
+		},
+	})
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestACL(t *testing.T) {
+	engine, db := setupTestDB(t)
+
+	var datasources []model.Datasource
+	for _, name := range []string{"public", "private"} {
+		datasource := model.Datasource{Name: name, Type: model.LOCAL, Cwd: t.TempDir()}
+		if err := db.Create(&datasource).Error; err != nil {
+			t.Fatal(err)
+		}
+		datasources = append(datasources, datasource)
+	}
+	public, private := datasources[0], datasources[1]
+
+	for _, preview := range []model.Preview{
+		{DatasourceID: public.ID, Key: model.BuildPreviewKey(public, "/shared/a.mp4")},
+		{DatasourceID: public.ID, Key: model.BuildPreviewKey(public, "/shared_not/b.mp4")},
+		{DatasourceID: public.ID, Key: model.BuildPreviewKey(public, "/c.mp4")},
+		{DatasourceID: private.ID, Key: model.BuildPreviewKey(private, "/shared/d.mp4")},
+	} {
+		if err := db.Create(&preview).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := model.User{Username: "guest"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	group := model.Group{Name: "guests"}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.GroupMember{GroupID: group.ID, UserID: user.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.Permission{
+		DatasourceID: public.ID,
+		Path:         "/shared",
+		GroupID:      group.ID,
+		Actions:      model.ActionList | model.ActionRead,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	api := engine.Group("api", func(context *gin.Context) {
+		context.Set(userContextKey, &user)
+	})
+	if err := SetupDatasourceController(api.Group("datasource"), db); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupPreviewController(api.Group("preview"), db); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target string, body any, data any) gocrud.Code {
+		return responseCode(t, request(engine, method, target, body, nil), data)
+	}
+	get := func(target string, data any) gocrud.Code {
+		return send(http.MethodGet, target, nil, data)
+	}
+
+	var all []model.Datasource
+	get("/api/datasource/all", &all)
+	if len(all) != 1 || all[0].ID != public.ID {
+		t.Fatalf("expected only the public datasource, got %v", all)
+	}
+
+	var previews []model.Preview
+	get("/api/preview/page/1/10", &previews)
+	var keys []model.FileKey
+	for _, preview := range previews {
+		keys = append(keys, preview.Key)
+	}
+	if expected := []model.FileKey{model.BuildPreviewKey(public, "/shared/a.mp4")}; !slices.Equal(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+
+	var count int64
+	get("/api/preview/count", &count)
+	if count != 1 {
+		t.Fatalf("expected 1 readable preview, got %d", count)
+	}
+
+	for target, forbidden := range map[string]bool{
+		"/api/datasource/readdir/1/":        false,
+		"/api/datasource/readdir/1/shared":  false,
+		"/api/datasource/readdir/1/private": true,
+		"/api/datasource/readdir/2/":        true,
+	} {
+		code := get(target, nil)
+		if (code == gocrud.RestCoder.FromStatus(http.StatusForbidden)) != forbidden {
+			t.Fatalf("%s: unexpected code %s", target, code)
+		}
+	}
+
+	// raw preview rows are not editable by users who can only generate, nor can they point outside the preview folder
+	forged := model.Preview{Key: model.BuildPreviewKey(public, "/shared/a.mp4"), Cover: "../secret.txt"}
+	forged.ID = 4
+	if code := send(http.MethodPut, "/api/preview", forged, nil); code != gocrud.RestCoder.FromStatus(http.StatusForbidden) {
+		t.Fatalf("expected saving a preview to be forbidden, got %s", code)
+	}
+
+	folder := env.PreviewFolder
+	env.PreviewFolder = path.Join(t.TempDir(), "preview")
+	defer func() {
+		env.PreviewFolder = folder
+	}()
+	if err := os.MkdirAll(env.PreviewFolder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(env.PreviewFolder, "..", "secret.txt"), []byte(secret), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&model.Preview{}).Where("`key` = ?", forged.Key).Update("cover", forged.Cover).Error; err != nil {
+		t.Fatal(err)
+	}
+	recorder := request(engine, http.MethodGet, "/api/preview/by-key/"+string(forged.Key), nil, nil)
+	if recorder.Code != http.StatusFound || bytes.Contains(recorder.Body.Bytes(), []byte(secret)) {
+		t.Fatalf("expected a cover outside the preview folder not to be served, got %d", recorder.Code)
+	}
+
+	// datasource admins can rename their datasource, but not point it elsewhere
+	keeper := model.User{Username: "keeper"}
+	if err := db.Create(&keeper).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.Permission{
+		DatasourceID: private.ID,
+		Path:         "/",
+		UserID:       keeper.ID,
+		Actions:      model.ActionAdmin,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	user = keeper
+
+	renamed := private
+	renamed.Name = "renamed"
+	if code := send(http.MethodPut, "/api/datasource", renamed, nil); code != gocrud.RestCoder.OK() {
+		t.Fatalf("expected datasource admin to rename, got %s", code)
+	}
+	for _, moved := range []model.Datasource{
+		{Name: "moved", Type: private.Type, Cwd: "/"},
+		{Name: "moved", Type: model.DUFS, Cwd: private.Cwd},
+		{Name: "moved", Type: private.Type, Cwd: private.Cwd, TLS: model.TLSSettings{InsecureSkipVerify: true}},
+		{Name: "moved", Type: private.Type, Cwd: private.Cwd, TLS: model.TLSSettings{ClientKey: "/etc/ssl/private/server.key"}},
+	} {
+		moved.ID = private.ID
+		if code := send(http.MethodPut, "/api/datasource", moved, nil); code != gocrud.RestCoder.FromStatus(http.StatusForbidden) {
+			t.Fatalf("expected datasource admin not to change type, cwd or tls, got %s", code)
+		}
+	}
+	if code := send(http.MethodPut, "/api/datasource", model.Datasource{Name: "new", Type: model.LOCAL, Cwd: "/"}, nil); code != gocrud.RestCoder.FromStatus(http.StatusForbidden) {
+		t.Fatalf("expected datasource admin not to create datasources, got %s", code)
+	}
+}
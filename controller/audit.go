@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const shareContextKey = "goview.share"
+
+// audit records event with who sent the request, failures are logged only and never fail the request
+func audit(context *gin.Context, db *gorm.DB, event model.AuditEvent) {
+	if !env.EnableAudit {
+		return
+	}
+
+	if user := CurrentUser(context); user != nil {
+		event.UserID = user.ID
+		event.Username = user.Username
+	}
+	if share, ok := context.Get(shareContextKey); ok {
+		event.ShareID = share.(*model.Share).ID
+	}
+	event.IP = context.ClientIP()
+	event.UserAgent = context.Request.UserAgent()
+
+	// db may be a query in progress, e.g. in DidSave
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&event).Error; err != nil {
+		l.Error().Printf("Failed to record audit event %s of %s: %v", event.Action, event.Path, err)
+	}
+}
+
+// parseAuditTime accepts RFC 3339, nil to skip the filter
+func parseAuditTime(value string) any {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+var auditSearchHandlers = gocrud.SearchHandlers{
+	"action":           gocrud.KeywordEqual("action", nil),
+	"in_action":        gocrud.KeywordIn("action", nil),
+	"userId":           gocrud.KeywordEqual("user_id", nil),
+	"username":         gocrud.KeywordEqual("username", nil),
+	"shareId":          gocrud.KeywordEqual("share_id", nil),
+	"datasourceId":     gocrud.KeywordEqual("datasource_id", nil),
+	"path":             gocrud.KeywordLike("path", nil),
+	"ip":               gocrud.KeywordEqual("ip", nil),
+	"since":            gocrud.KeywordStatement("created_at", gocrud.OperatorGte, parseAuditTime),
+	"until":            gocrud.KeywordStatement("created_at", gocrud.OperatorLt, parseAuditTime),
+	"sortBy_id":        gocrud.SortBy("id"),
+	"sortBy_createdAt": gocrud.SortBy("created_at"),
+}
+
+// SetupAuditController is read only, events can not be changed or deleted through api
+func SetupAuditController(group *gin.RouterGroup, db *gorm.DB) error {
+	err := gocrud.New(group, db, gocrud.Crud[model.AuditEvent]{
+		SearchHandlers: auditSearchHandlers,
+		DisableSave:    true,
+		DisableDelete:  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	// export streams the events matching the same filters as JSON Lines
+	group.GET("/export", func(context *gin.Context) {
+		query := context.Request.URL.Query()
+
+		tx := db.Model(&model.AuditEvent{})
+		for key, values := range query {
+			if handler, ok := auditSearchHandlers[key]; ok {
+				tx = handler(tx, slices.Clone(values), query)
+			}
+		}
+
+		filename := "audit-" + time.Now().Format("20060102-150405") + ".jsonl"
+		context.Header("Content-Type", "application/jsonl")
+		context.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		context.Status(http.StatusOK)
+
+		encoder := json.NewEncoder(context.Writer)
+
+		var batch []model.AuditEvent
+		err := tx.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, event := range batch {
+				if err := encoder.Encode(event); err != nil {
+					return err
+				}
+			}
+			context.Writer.Flush()
+			return nil
+		}).Error
+		if err != nil {
+			// too late to respond with an error, the client gets a truncated export
+			l.Error().Printf("Failed to export audit events: %v", err)
+		}
+	})
+
+	return nil
+}
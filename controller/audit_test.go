@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAudit(t *testing.T) {
+	tmp := t.TempDir()
+	root := path.Join(tmp, "root")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(root, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, db := setupTestDB(t)
+	if err := db.Create(&model.Datasource{Name: "local", Type: model.LOCAL, Cwd: root}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	user := model.User{Username: "alice", Admin: true}
+	user.ID = 7
+
+	api := engine.Group("api", func(context *gin.Context) {
+		context.Set(userContextKey, &user)
+	})
+	if err := SetupDatasourceController(api.Group("datasource"), db); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupAuditController(api.Group("audit"), db); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(target string, header http.Header) *httptest.ResponseRecorder {
+		return request(engine, http.MethodGet, target, nil, header)
+	}
+
+	serve("/api/datasource/by-ds/1/a.txt", nil)
+	serve("/api/datasource/by-ds/1/a.txt", http.Header{"Range": {"bytes=1-2"}})
+
+	var events []model.AuditEvent
+	responseCode(t, serve("/api/audit/page/1/10?action=file.serve&sortBy_id=asc", nil), &events)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %v", events)
+	}
+	if event := events[0]; event.UserID != user.ID || event.Username != "alice" || event.Path != "/a.txt" || event.Bytes != 5 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if event := events[1]; event.Range != "bytes=1-2" || event.Bytes != 2 {
+		t.Fatalf("expected a ranged event, got %+v", event)
+	}
+
+	recorder := serve("/api/audit/export?action=file.serve&since=2000-01-01T00:00:00Z", nil)
+	if disposition := recorder.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment") {
+		t.Fatalf("expected an attachment, got %q", disposition)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var event model.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Fatalf("expected 2 exported events, got %d", lines)
+	}
+
+	if body := serve("/api/audit/export?until=2000-01-01T00:00:00Z", nil).Body.String(); body != "" {
+		t.Fatalf("expected nothing before 2000, got %q", body)
+	}
+}
@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	SessionCookie      = "goview_session"
+	userContextKey     = "goview.user"
+	apiTokenContextKey = "goview.api_token"
+)
+
+type LoginBody struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type LoginResult struct {
+	Token     string     `json:"token"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	User      model.User `json:"user"`
+}
+
+type PasswordBody struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// CurrentUser returns the user authenticated by AuthMiddleware, nil if auth is disabled
+func CurrentUser(context *gin.Context) *model.User {
+	user, ok := context.Get(userContextKey)
+	if !ok {
+		return nil
+	}
+	return user.(*model.User)
+}
+
+// CurrentApiToken returns the api token the request is authenticated with, nil for sessions and basic auth
+func CurrentApiToken(context *gin.Context) *model.ApiToken {
+	token, ok := context.Get(apiTokenContextKey)
+	if !ok {
+		return nil
+	}
+	return token.(*model.ApiToken)
+}
+
+func findUserByPassword(db *gorm.DB, username, password string) (*model.User, error) {
+	var user model.User
+	err := db.First(&user, "`username` = ? AND `deleted_at` IS NULL", username).Error
+	if err != nil || user.Disabled || !user.CheckPassword(password) {
+		return nil, model.ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+func findUserBySession(db *gorm.DB, token string) (*model.User, error) {
+	var session model.Session
+	if err := db.First(&session, "`token` = ? AND `deleted_at` IS NULL", model.HashToken(token)).Error; err != nil {
+		return nil, err
+	}
+
+	if session.ExpiresAt.Before(time.Now()) {
+		_ = db.Delete(&session).Error
+		return nil, errors.New("session expired")
+	}
+
+	var user model.User
+	if err := db.First(&user, "`id` = ? AND `deleted_at` IS NULL", session.UserID).Error; err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, errors.New("user disabled")
+	}
+
+	return &user, nil
+}
+
+func findUserByApiToken(db *gorm.DB, token string) (*model.User, *model.ApiToken, error) {
+	var apiToken model.ApiToken
+	if err := db.First(&apiToken, "`token` = ? AND `deleted_at` IS NULL", model.HashToken(token)).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if apiToken.Expired(time.Now()) {
+		return nil, nil, errors.New("api token expired")
+	}
+
+	var user model.User
+	if err := db.First(&user, "`id` = ? AND `deleted_at` IS NULL", apiToken.UserID).Error; err != nil {
+		return nil, nil, err
+	}
+	if user.Disabled {
+		return nil, nil, errors.New("user disabled")
+	}
+
+	return &user, &apiToken, nil
+}
+
+// touchApiToken records the last use of token, failures only lose the record
+func touchApiToken(db *gorm.DB, token *model.ApiToken, ip string) {
+	now := time.Now()
+	err := db.Model(token).UpdateColumns(map[string]any{
+		"last_used_at": now,
+		"last_used_ip": ip,
+	}).Error
+	if err != nil {
+		l.Warn().Printf("Failed to record last use of api token %d: %v", token.ID, err)
+	}
+}
+
+// authenticate checks session cookie, bearer token and basic auth in order,
+// basic is true when the user is authenticated with password
+func authenticate(context *gin.Context, db *gorm.DB) (user *model.User, basic bool, err error) {
+	if token, err := context.Cookie(SessionCookie); err == nil && token != "" {
+		if user, err := findUserBySession(db, token); err == nil {
+			return user, false, nil
+		}
+	}
+
+	if token, found := strings.CutPrefix(context.GetHeader("Authorization"), "Bearer "); found {
+		token = strings.TrimSpace(token)
+		if !strings.HasPrefix(token, model.ApiTokenPrefix) {
+			user, err := findUserBySession(db, token)
+			return user, false, err
+		}
+
+		user, apiToken, err := findUserByApiToken(db, token)
+		if err != nil {
+			return nil, false, err
+		}
+		touchApiToken(db, apiToken, context.ClientIP())
+		context.Set(apiTokenContextKey, apiToken)
+		return user, false, nil
+	}
+
+	if username, password, ok := context.Request.BasicAuth(); ok {
+		user, err := findUserByPassword(db, username, password)
+		return user, true, err
+	}
+
+	return nil, false, model.ErrInvalidCredentials
+}
+
+func issueSession(context *gin.Context, db *gorm.DB, user model.User) (*LoginResult, error) {
+	ttl := time.Duration(env.SessionTTLHours) * time.Hour
+
+	token, session, err := model.NewSession(user, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Create(session).Error; err != nil {
+		return nil, err
+	}
+
+	secure := context.Request.TLS != nil || context.GetHeader("X-Forwarded-Proto") == "https"
+	context.SetSameSite(http.SameSiteLaxMode)
+	context.SetCookie(SessionCookie, token, int(ttl.Seconds()), "/", "", secure, true)
+
+	user.Password = ""
+	return &LoginResult{Token: token, ExpiresAt: session.ExpiresAt, User: user}, nil
+}
+
+// NewAuthMiddleware rejects requests without valid credentials,
+// ui asks browsers for basic auth and turns it into a session cookie so that api calls of ui pass too
+func NewAuthMiddleware(db *gorm.DB, ui bool) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if !env.EnableAuth {
+			context.Next()
+			return
+		}
+
+		user, basic, err := authenticate(context, db)
+		if err != nil {
+			if ui {
+				context.Header("WWW-Authenticate", `Basic realm="goview", charset="UTF-8"`)
+				context.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusUnauthorized), err)
+			return
+		}
+
+		if ui && basic {
+			if _, err := issueSession(context, db, *user); err != nil {
+				l.Error().Printf("Failed to issue session for %s: %v", user.Username, err)
+			}
+		}
+
+		context.Set(userContextKey, user)
+		context.Next()
+	}
+}
+
+// RequireAdmin must be placed after the middleware from NewAuthMiddleware
+func RequireAdmin(context *gin.Context) {
+	if !env.EnableAuth {
+		context.Next()
+		return
+	}
+
+	if user := CurrentUser(context); user == nil || !user.Admin {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "admin only")
+		return
+	} else if token := CurrentApiToken(context); token != nil && !token.Has(model.ScopeAdmin) {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "admin scope required")
+		return
+	}
+
+	context.Next()
+}
+
+// BootstrapAdmin creates the first admin from env when there is no user at all
+func BootstrapAdmin(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&model.User{}).Count(&count).Error; err != nil {
+		return err
+	} else if count > 0 {
+		return nil
+	}
+
+	password := env.AdminPassword
+	if password == "" {
+		generated, err := model.RandomToken(12)
+		if err != nil {
+			return err
+		}
+		password = generated
+		l.Warn().Printf("Generated password for admin %s: %s", env.AdminUsername, password)
+	}
+
+	hash, err := model.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return db.Create(&model.User{Username: env.AdminUsername, Password: hash, Admin: true}).Error
+}
+
+func SetupAuthController(group *gin.RouterGroup, db *gorm.DB) error {
+	authenticated := NewAuthMiddleware(db, false)
+
+	group.POST("/login", NewLoginRateLimitMiddleware(), func(context *gin.Context) {
+		var body LoginBody
+		if err := context.ShouldBindJSON(&body); err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		user, err := findUserByPassword(db, body.Username, body.Password)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusUnauthorized), err)
+			return
+		}
+
+		result, err := issueSession(context, db, *user)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[LoginResult]{
+			Code: gocrud.RestCoder.OK(),
+			Data: *result,
+		})
+	})
+
+	group.POST("/logout", func(context *gin.Context) {
+		token, _ := context.Cookie(SessionCookie)
+		if bearer, found := strings.CutPrefix(context.GetHeader("Authorization"), "Bearer "); found {
+			token = strings.TrimSpace(bearer)
+		}
+
+		if token != "" {
+			if err := db.Where("`token` = ?", model.HashToken(token)).Delete(&model.Session{}).Error; err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+				return
+			}
+		}
+
+		context.SetCookie(SessionCookie, "", -1, "/", "", false, true)
+		context.JSON(http.StatusOK, gocrud.R[bool]{
+			Code: gocrud.RestCoder.OK(),
+			Data: true,
+		})
+	})
+
+	group.GET("/me", authenticated, func(context *gin.Context) {
+		user := CurrentUser(context)
+		if user == nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), "auth is disabled")
+			return
+		}
+
+		me := *user
+		me.Password = ""
+		context.JSON(http.StatusOK, gocrud.R[model.User]{
+			Code: gocrud.RestCoder.OK(),
+			Data: me,
+		})
+	})
+
+	group.POST("/password", authenticated, func(context *gin.Context) {
+		user := CurrentUser(context)
+		if user == nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), "auth is disabled")
+			return
+		}
+
+		var body PasswordBody
+		if err := context.ShouldBindJSON(&body); err != nil || body.New == "" {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "new password is required")
+			return
+		}
+
+		if !user.CheckPassword(body.Old) {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusUnauthorized), model.ErrInvalidCredentials)
+			return
+		}
+
+		hash, err := model.HashPassword(body.New)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		if err := db.Model(user).Update("password", hash).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[bool]{
+			Code: gocrud.RestCoder.OK(),
+			Data: true,
+		})
+	})
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuth(t *testing.T) {
+	engine, db := setupTestDB(t)
+
+	password := env.AdminPassword
+	env.AdminPassword = "secret"
+	defer func() {
+		env.AdminPassword = password
+	}()
+
+	if err := BootstrapAdmin(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetupAuthController(engine.Group("api/auth"), db); err != nil {
+		t.Fatal(err)
+	}
+	engine.GET("/api/ping", NewAuthMiddleware(db, false), func(context *gin.Context) {
+		context.String(http.StatusOK, "pong")
+	})
+	engine.GET("/ui/", NewAuthMiddleware(db, true), func(context *gin.Context) {
+		context.String(http.StatusOK, "ui")
+	})
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if body := serve(httptest.NewRequest(http.MethodGet, "/api/ping", nil)).Body.String(); body == "pong" {
+		t.Errorf("anonymous request should be rejected")
+	}
+
+	recorder := serve(httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	if recorder.Code != http.StatusUnauthorized || recorder.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("ui should ask for basic auth, got %d", recorder.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username":"admin","password":"wrong"}`))
+	var failed gocrud.R[any]
+	if err := json.Unmarshal(serve(req).Body.Bytes(), &failed); err != nil {
+		t.Fatal(err)
+	}
+	if failed.Code == gocrud.RestCoder.OK() {
+		t.Errorf("wrong password should be rejected")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username":"admin","password":"secret"}`))
+	var login gocrud.R[LoginResult]
+	if err := json.Unmarshal(serve(req).Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+	if login.Code != gocrud.RestCoder.OK() || login.Data.Token == "" || !login.Data.User.Admin || login.Data.User.Password != "" {
+		t.Fatalf("unexpected login result %+v", login)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Data.Token)
+	if body := serve(req).Body.String(); body != "pong" {
+		t.Errorf("bearer token should be accepted, got %s", body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/ui/", nil)
+	req.SetBasicAuth("admin", "secret")
+	recorder = serve(req)
+	if recorder.Body.String() != "ui" {
+		t.Errorf("basic auth should be accepted by ui")
+	}
+
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != SessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("ui should issue a session cookie, got %v", cookies)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.AddCookie(cookies[0])
+	if body := serve(req).Body.String(); body != "pong" {
+		t.Errorf("session cookie should be accepted, got %s", body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Data.Token)
+	serve(req)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Data.Token)
+	if body := serve(req).Body.String(); body == "pong" {
+		t.Errorf("token should be revoked after logout")
+	}
+}
@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"io"
 	"io/fs"
+	"mime"
 	"net/http"
-	"net/url"
+	"os"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,6 +26,7 @@ type FileInfo struct {
 	Size  int64     `json:"size"`
 	MTime time.Time `json:"mtime"`
 
+	IsArchive  bool          `json:"isArchive"`
 	Key        model.FileKey `json:"key"`
 	HasPreview bool          `json:"hasPreview"`
 }
@@ -36,16 +40,98 @@ func SetupDatasourceController(group *gin.RouterGroup, db *gorm.DB) error {
 		SearchHandlers: map[string]gocrud.SearchHandler{
 			"deleted": gocrud.NewSoftDeleteSearchHandler(""),
 		},
+		WillGetAll: func(context *gin.Context, db *gorm.DB) *gorm.DB {
+			acl, err := aclOf(context, db)
+			if err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+				return db
+			}
+			if ids := acl.DatasourceIDs(); ids != nil {
+				return db.Where("`id` IN ?", ids)
+			}
+			return db
+		},
+		WillSave: func(record *model.Datasource, context *gin.Context, db *gorm.DB) {
+			moveCwdCredentials(record, context, db)
+			if context.IsAborted() {
+				return
+			}
+
+			if !authorizeDatasourceSave(record, context, db) {
+				return
+			}
+
+			sealCredentials(record, context, db)
+			if context.IsAborted() {
+				return
+			}
+
+			// ?skipTest=1 saves a datasource that is offline for now, unchecked until the next health check
+			if _, skip := context.GetQuery("skipTest"); skip {
+				record.Health = model.Health{}
+				return
+			}
+			result := testConnectivity(*record)
+			if result.Status == model.HealthDown {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "connection test failed: "+result.Error)
+				return
+			}
+			record.Health = result.Health(time.Now())
+		},
+		DidGetAll: func(records []model.Datasource, context *gin.Context, db *gorm.DB) {
+			for i := range records {
+				records[i].Cwd, _ = model.SplitCwdCredentials(records[i].Cwd)
+			}
+		},
+		DidSave: func(record *model.Datasource, context *gin.Context, db *gorm.DB) {
+			record.Credentials = nil
+			record.Cwd, _ = model.SplitCwdCredentials(record.Cwd)
+			record.HasCredentials = record.SealedCredentials != ""
+			model.ForgetUnionFS()
+			audit(context, db, model.AuditEvent{
+				Action:       model.AuditDatasourceSave,
+				DatasourceID: record.ID,
+				Detail:       record.Name,
+			})
+		},
+		WillDelete: func(context *gin.Context, db *gorm.DB) {
+			id, err := strconv.ParseUint(context.Param("id"), 10, 64)
+			if err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+				return
+			}
+			authorize(context, db, gocrud.ID(id), "/", model.ActionAdmin)
+		},
 		OnDelete: gocrud.NewSoftDeleteHandler[model.Datasource](gocrud.RestCoder),
+		DidDelete: func(context *gin.Context, db *gorm.DB) {
+			id, _ := strconv.ParseUint(context.Param("id"), 10, 64)
+			model.ForgetUnionFS()
+			audit(context, db, model.AuditEvent{
+				Action:       model.AuditDatasourceDelete,
+				DatasourceID: gocrud.ID(id),
+			})
+		},
 	})
 
 	if err != nil {
 		return err
 	}
 
+	model.DatasourceLoader = func(id gocrud.ID) (model.Datasource, error) {
+		var datasource model.Datasource
+		err := db.First(&datasource, id).Error
+		return datasource, err
+	}
+
+	setupDatasourceWriteRoutes(group, db)
+	setupDatasourceHealthRoutes(group, db)
+
 	group.GET("/readdir/:datasource/*wd", func(context *gin.Context) {
 		datasourceId := context.Param("datasource")
-		wd := context.Param("wd")
+		wd, ok := pathParam(context, "wd")
+		if !ok {
+			return
+		}
 
 		var datasource model.Datasource
 		if err := db.First(&datasource, datasourceId).Error; err != nil {
@@ -53,6 +139,15 @@ func SetupDatasourceController(group *gin.RouterGroup, db *gorm.DB) error {
 			return
 		}
 
+		acl, err := aclOf(context, db)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		} else if !acl.Leads(datasource.ID, wd, model.ActionList) {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "permission denied")
+			return
+		}
+
 		dfs, err := model.GetFS(datasource)
 		if err != nil {
 			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
@@ -65,64 +160,31 @@ func SetupDatasourceController(group *gin.RouterGroup, db *gorm.DB) error {
 			return
 		}
 
-		var waitGroup sync.WaitGroup
-
-		keys := make([]model.FileKey, len(entries))
-		files := make([]FileInfo, len(entries))
-		for i, entry := range entries {
-			waitGroup.Add(1)
-			go func(i int, entry fs.DirEntry) {
-				defer waitGroup.Done()
-
-				info, err := entry.Info()
-				if err != nil {
-					return
-				}
-
-				keys[i] = model.BuildPreviewKey(datasource, path.Join(wd, info.Name()))
-				files[i] = FileInfo{
-					Name:       info.Name(),
-					IsDir:      info.IsDir(),
-					Size:       info.Size(),
-					MTime:      info.ModTime(),
-					HasPreview: false,
-					Key:        keys[i],
-				}
-			}(i, entry)
+		if !acl.Can(datasource.ID, wd, model.ActionList) {
+			// only the way to granted sub folders is visible
+			entries = slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+				return !acl.Leads(datasource.ID, path.Join(wd, entry.Name()), model.ActionList)
+			})
 		}
 
-		waitGroup.Wait()
-
-		var previews []model.Preview
-		if err := db.Find(&previews, "`key` IN ?", keys).Error; err != nil {
+		files, err := fileInfos(db, datasource, wd, entries)
+		if err != nil {
 			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
 			return
 		}
 
-		for index := range previews {
-			waitGroup.Add(1)
-			go func(preview *model.Preview) {
-				defer waitGroup.Done()
-				for i, file := range files {
-					if file.Key == preview.Key {
-						files[i].HasPreview = true
-						return
-					}
-				}
-			}(&previews[index])
-		}
-
-		waitGroup.Wait()
-
 		context.JSON(http.StatusOK, gocrud.R[[]FileInfo]{
 			Code: gocrud.RestCoder.OK(),
 			Data: files,
 		})
 	})
 
-	group.GET("/by-ds/:datasource/*wd", func(context *gin.Context) {
+	group.GET("/by-ds/:datasource/*wd", limitStreams(datasourceOfParams), func(context *gin.Context) {
 		datasourceId := context.Param("datasource")
-		wd := context.Param("wd")
+		wd, ok := pathParam(context, "wd")
+		if !ok {
+			return
+		}
 
 		id, err := strconv.Atoi(datasourceId)
 		if err != nil {
@@ -130,34 +192,266 @@ func SetupDatasourceController(group *gin.RouterGroup, db *gorm.DB) error {
 			return
 		}
 
-		serveFile(context, db, gocrud.ID(id), wd)
+		serveFile(context, db, gocrud.ID(id), wd, nil)
 	})
 
-	group.GET("/by-key/*key", func(context *gin.Context) {
-		key := context.Param("key")
+	// zip streams the folder wd, or the files selected with ?path= relative to wd
+	group.GET("/zip/:datasource/*wd", limitStreams(datasourceOfParams), func(context *gin.Context) {
+		datasourceId := context.Param("datasource")
+		wd, ok := pathParam(context, "wd")
+		if !ok {
+			return
+		}
+		paths := context.QueryArray("path")
+
+		var datasource model.Datasource
+		if err := db.First(&datasource, datasourceId).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		}
+
+		if !authorize(context, db, datasource.ID, wd, model.ActionRead) {
+			return
+		}
 
-		u, err := url.Parse(strings.TrimPrefix(key, "/"))
+		dfs, err := model.GetFS(datasource)
 		if err != nil {
-			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
 			return
 		}
 
-		dsId := u.Hostname()
-		wd := u.Path
+		stat, err := dfs.Stat(wd)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		} else if !stat.IsDir() {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "not a folder")
+			return
+		}
 
-		id, err := strconv.Atoi(dsId)
+		filename := path.Base(wd)
+		if wd == "/" {
+			filename = datasource.Name
+		}
+
+		serveZip(context, db, dfs, datasource.ID, wd, paths, filename)
+	})
+
+	group.GET("/by-key/*key", limitStreams(datasourceOfParams), func(context *gin.Context) {
+		key := model.FileKey(strings.TrimPrefix(context.Param("key"), "/"))
+
+		id, wd := key.Split()
+		if id == 0 {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "invalid key")
+			return
+		}
+
+		wd, err := model.CleanPath(wd)
 		if err != nil {
 			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
 			return
 		}
 
-		serveFile(context, db, gocrud.ID(id), wd)
+		serveFile(context, db, id, wd, nil)
 	})
 
 	return nil
 }
 
-func serveFile(context *gin.Context, db *gorm.DB, datasourceId gocrud.ID, wd string) {
+// authorizeDatasourceSave allows admins to save any datasource,
+// admins of a datasource may change anything but where it points to, which could expose the host or another server
+func authorizeDatasourceSave(record *model.Datasource, context *gin.Context, db *gorm.DB) bool {
+	acl, err := aclOf(context, db)
+	if err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+		return false
+	} else if acl.IsAdmin() {
+		return true
+	}
+
+	if record.ID == 0 {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "admin only")
+		return false
+	} else if !authorize(context, db, record.ID, "/", model.ActionAdmin) {
+		return false
+	}
+
+	var existing model.Datasource
+	if err := db.First(&existing, record.ID).Error; err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+		return false
+	}
+
+	// tls settings may skip verification or load any key file on the server
+	if record.Type != existing.Type || record.Cwd != existing.Cwd || record.TLS != existing.TLS {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "only admins can change type, cwd or tls")
+		return false
+	}
+
+	return true
+}
+
+// moveCwdCredentials moves the password in cwd into credentials, so that it is sealed and never sent back
+func moveCwdCredentials(record *model.Datasource, context *gin.Context, db *gorm.DB) {
+	cwd, fromCwd := model.SplitCwdCredentials(record.Cwd)
+	if fromCwd.IsZero() {
+		return
+	}
+	record.Cwd = cwd
+
+	if record.Credentials != nil {
+		// credentials sent along win over the ones in cwd
+		if record.Credentials.Username == "" {
+			record.Credentials.Username = fromCwd.Username
+		}
+		if record.Credentials.Password == "" {
+			record.Credentials.Password = fromCwd.Password
+		}
+		return
+	}
+
+	// keep the rest of stored credentials, e.g. a private key
+	credentials := model.Credentials{}
+	if record.ID != 0 {
+		var existing model.Datasource
+		err := db.First(&existing, record.ID).Error
+		if err == nil && existing.Type == record.Type && model.SameEndpoint(existing.Cwd, cwd) {
+			credentials, err = model.OpenCredentials(existing.SealedCredentials)
+			if err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+				return
+			}
+		}
+	}
+	credentials.Username, credentials.Password = fromCwd.Username, fromCwd.Password
+	record.Credentials = &credentials
+}
+
+// sealCredentials encrypts the credentials sent by client, or keeps the stored ones if none is sent,
+// stored ones are dropped once cwd points to another server, or they would be sent to it
+func sealCredentials(record *model.Datasource, context *gin.Context, db *gorm.DB) {
+	if record.Credentials == nil {
+		record.SealedCredentials = ""
+		if record.ID != 0 {
+			var existing model.Datasource
+			if err := db.First(&existing, record.ID).Error; err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+				return
+			}
+			if existing.Type == record.Type && model.SameEndpoint(existing.Cwd, record.Cwd) {
+				record.SealedCredentials = existing.SealedCredentials
+			}
+		}
+		return
+	}
+
+	sealed, err := model.SealCredentials(*record.Credentials)
+	if err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+		return
+	}
+	record.SealedCredentials = sealed
+}
+
+// fileInfos stats entries of folder wd concurrently and marks the ones with a preview
+func fileInfos(db *gorm.DB, datasource model.Datasource, wd string, entries []fs.DirEntry) ([]FileInfo, error) {
+	var waitGroup sync.WaitGroup
+
+	keys := make([]model.FileKey, len(entries))
+	files := make([]FileInfo, len(entries))
+	for i, entry := range entries {
+		waitGroup.Add(1)
+		go func(i int, entry fs.DirEntry) {
+			defer waitGroup.Done()
+
+			info, err := entry.Info()
+			if err != nil {
+				return
+			}
+
+			source := datasource
+			if sourced, ok := entry.(model.UnionDirEntry); ok {
+				source = sourced.Source
+			}
+
+			keys[i] = model.BuildPreviewKey(source, path.Join(wd, info.Name()))
+			files[i] = FileInfo{
+				Name:       info.Name(),
+				IsDir:      info.IsDir(),
+				Size:       info.Size(),
+				MTime:      info.ModTime(),
+				IsArchive:  !info.IsDir() && model.IsArchive(info.Name()),
+				HasPreview: false,
+				Key:        keys[i],
+			}
+		}(i, entry)
+	}
+
+	waitGroup.Wait()
+
+	var previews []model.Preview
+	if err := db.Find(&previews, "`key` IN ?", keys).Error; err != nil {
+		return nil, err
+	}
+
+	for index := range previews {
+		waitGroup.Add(1)
+		go func(preview *model.Preview) {
+			defer waitGroup.Done()
+			for i, file := range files {
+				if file.Key == preview.Key {
+					files[i].HasPreview = true
+					return
+				}
+			}
+		}(&previews[index])
+	}
+
+	waitGroup.Wait()
+
+	return files, nil
+}
+
+// serveZip streams folder wd of dfs, or the selected paths in it, as filename.zip
+func serveZip(context *gin.Context, db *gorm.DB, dfs model.DatasourceFS, datasourceID gocrud.ID, wd string, paths []string, filename string) {
+	context.Header("Content-Type", "application/zip")
+	context.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename + ".zip"}))
+	context.Writer.WriteHeaderNow()
+
+	err := model.WriteZip(dfs, context.Writer, wd, paths)
+	context.Writer.Flush()
+
+	event := model.AuditEvent{
+		Action:       model.AuditFileZip,
+		DatasourceID: datasourceID,
+		Path:         wd,
+		Bytes:        int64(context.Writer.Size()),
+		Detail:       strings.Join(paths, ","),
+	}
+	if err != nil {
+		// too late to respond with an error, the client gets a truncated zip
+		l.Error().Printf("Failed to zip %s of datasource %d: %v", wd, datasourceID, err)
+		event.Detail = err.Error()
+	}
+	audit(context, db, event)
+}
+
+// pathParam returns the cleaned path in route param key,
+// responds with bad request if it tries to escape the datasource
+func pathParam(context *gin.Context, key string) (string, bool) {
+	name, err := model.CleanPath(context.Param(key))
+	if err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+		return "", false
+	}
+	return name, true
+}
+
+// fileAdmitter decides whether file of stat is served, and responds if not
+type fileAdmitter func(stat fs.FileInfo, seekable bool) bool
+
+// serveFile streams wd, admit is optional
+func serveFile(context *gin.Context, db *gorm.DB, datasourceId gocrud.ID, wd string, admit fileAdmitter) {
 	var datasource model.Datasource
 	if err := db.First(&datasource, datasourceId).Error; err != nil {
 		context.Header("Cache-Control", "no-cache")
@@ -165,6 +459,12 @@ func serveFile(context *gin.Context, db *gorm.DB, datasourceId gocrud.ID, wd str
 		return
 	}
 
+	if !can(context, db, datasource.ID, wd, model.ActionRead) {
+		context.Header("Cache-Control", "no-cache")
+		context.Data(http.StatusForbidden, assets.MIMEType, assets.IV404)
+		return
+	}
+
 	dfs, err := model.GetFS(datasource)
 	if err != nil {
 		l.Error().Printf("Failed to get fs for datasource %d: %v", datasource.ID, err)
@@ -180,6 +480,9 @@ func serveFile(context *gin.Context, db *gorm.DB, datasourceId gocrud.ID, wd str
 		context.Data(http.StatusInternalServerError, assets.MIMEType, assets.IV500)
 		return
 	}
+	defer func() {
+		_ = file.Close()
+	}()
 
 	stat, err := file.Stat()
 	if err != nil {
@@ -193,24 +496,59 @@ func serveFile(context *gin.Context, db *gorm.DB, datasourceId gocrud.ID, wd str
 		return
 	}
 
+	// remote files fetch each Read from upstream, so they serve through Seek only when a part of them is asked for
+	seeker, seekable := file.(io.ReadSeeker)
+	if _, local := file.(*os.File); !local && context.GetHeader("Range") == "" && context.GetHeader("If-Range") == "" {
+		seekable = false
+	}
+	if admit != nil && !admit(stat, seekable) {
+		return
+	}
+
 	contentType := "stream/octet"
 
-	key := model.BuildPreviewKey(datasource, wd)
+	key := model.BuildPreviewKey(model.ResolveDatasource(datasource, wd), wd)
 	var preview model.Preview
 	if err := db.First(&preview, "`key` = ?", key).Error; err == nil {
 		contentType = preview.MIME
 	}
 
 	context.Header("Content-Type", contentType)
+
+	event := model.AuditEvent{
+		Action:       model.AuditFileServe,
+		DatasourceID: datasource.ID,
+		Path:         wd,
+	}
+
+	// files that can seek serve ranges, e.g. seeking in a video
+	if seekable {
+		http.ServeContent(context.Writer, context.Request, stat.Name(), stat.ModTime(), seeker)
+
+		event.Bytes = int64(max(context.Writer.Size(), 0))
+		if context.Writer.Status() == http.StatusPartialContent {
+			event.Range = context.GetHeader("Range")
+		}
+		audit(context, db, event)
+		return
+	}
+
+	context.Header("Accept-Ranges", "none")
 	context.Header("Content-Length", strconv.FormatInt(stat.Size(), 10))
 	context.Header("Last-Modified", stat.ModTime().Format(http.TimeFormat))
 	context.Writer.WriteHeaderNow()
 	context.Writer.Flush()
 
-	_, err = file.WriteTo(context.Writer)
+	sent, err := file.WriteTo(context.Writer)
+
+	event.Bytes = sent
 	if err != nil {
 		l.Error().Printf("Failed to write file %s: %v", wd, err)
-		return
+		event.Detail = err.Error()
+	}
+	audit(context, db, event)
+
+	if err == nil {
+		context.Writer.Flush()
 	}
-	context.Writer.Flush()
 }
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"golang.org/x/net/webdav"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const secret = "TOP SECRET"
+
+// setupTestDB opens an empty database in a temporary folder with every model migrated
+func setupTestDB(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(path.Join(t.TempDir(), "goview.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(
+		&model.Datasource{}, &model.Preview{},
+		&model.User{}, &model.Session{}, &model.ApiToken{},
+		&model.Group{}, &model.GroupMember{}, &model.Permission{},
+		&model.Share{}, &model.AuditEvent{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	return gin.New(), db
+}
+
+func setupTestServer(t *testing.T) (*gin.Engine, string) {
+	tmp := t.TempDir()
+	root := path.Join(tmp, "root")
+	outside := path.Join(tmp, "outside")
+
+	for _, dir := range []string{root, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path.Join(root, "inside.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(outside, "secret.txt"), []byte(secret), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"escape":          "../outside",
+		"abs":             outside,
+		"link-inside.txt": "inside.txt",
+	} {
+		if err := os.Symlink(target, path.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine, db := setupTestDB(t)
+	if err := db.Create(&model.Datasource{Name: "local", Type: model.LOCAL, Cwd: root}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	api := engine.Group("api")
+	if err := SetupDatasourceController(api.Group("datasource"), db); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupPreviewController(api.Group("preview"), db); err != nil {
+		t.Fatal(err)
+	}
+
+	return engine, root
+}
+
+// request serves target with body, which is sent as is if it is an io.Reader, or encoded as json otherwise
+func request(engine *gin.Engine, method, target string, body any, header http.Header) *httptest.ResponseRecorder {
+	reader, ok := body.(io.Reader)
+	if !ok {
+		var buf bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&buf).Encode(body)
+		}
+		reader = &buf
+	}
+
+	req := httptest.NewRequest(method, "/", reader)
+	// set after parsing, so that NUL and backslashes reach the router untouched
+	req.URL.Path, req.URL.RawQuery, _ = strings.Cut(target, "?")
+	if !ok && body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// responseCode decodes the gocrud.R in recorder, with its data into data
+func responseCode(t *testing.T, recorder *httptest.ResponseRecorder, data any) gocrud.Code {
+	r := gocrud.R[any]{Data: data}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &r); err != nil {
+		t.Fatalf("%d %q: %v", recorder.Code, recorder.Body.String(), err)
+	}
+	return r.Code
+}
+
+func TestMaliciousPaths(t *testing.T) {
+	engine, _ := setupTestServer(t)
+
+	paths := []string{
+		"/../outside/secret.txt",
+		"/../../../../../../etc/passwd",
+		"/./../outside/secret.txt",
+		"/escape/secret.txt",
+		"/abs/secret.txt",
+		"/inside.txt\x00.jpg",
+		"/..\\outside\\secret.txt",
+	}
+
+	for _, name := range paths {
+		for _, route := range []struct {
+			method string
+			prefix string
+		}{
+			{http.MethodGet, "/api/datasource/readdir/1"},
+			{http.MethodGet, "/api/datasource/by-ds/1"},
+			{http.MethodPut, "/api/preview/from-ds/1"},
+		} {
+			recorder := request(engine, route.method, route.prefix+name, nil, nil)
+			body, _ := io.ReadAll(recorder.Body)
+
+			if strings.Contains(string(body), secret) || strings.Contains(string(body), "root:") {
+				t.Errorf("%s %s%q leaked content", route.method, route.prefix, name)
+			}
+
+			var r gocrud.R[any]
+			if json.Unmarshal(body, &r) == nil && r.Code == gocrud.RestCoder.OK() {
+				t.Errorf("%s %s%q should fail", route.method, route.prefix, name)
+			}
+		}
+	}
+
+	for _, dir := range []string{"/escape", "/abs", "/.."} {
+		recorder := request(engine, http.MethodGet, "/api/datasource/readdir/1"+dir, nil, nil)
+
+		var r gocrud.R[any]
+		if err := json.Unmarshal(recorder.Body.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Code == gocrud.RestCoder.OK() {
+			t.Errorf("readdir %s should fail, got %v", dir, r.Data)
+		}
+	}
+}
+
+func TestLegitimatePaths(t *testing.T) {
+	engine, _ := setupTestServer(t)
+
+	for _, name := range []string{"/inside.txt", "/link-inside.txt", "//inside.txt", "/./inside.txt"} {
+		recorder := request(engine, http.MethodGet, "/api/datasource/by-ds/1"+name, nil, nil)
+		if recorder.Body.String() != "hello" {
+			t.Errorf("by-ds %s: unexpected body %q", name, recorder.Body.String())
+		}
+	}
+
+	recorder := request(engine, http.MethodGet, "/api/datasource/readdir/1/", nil, nil)
+
+	var r gocrud.R[[]FileInfo]
+	if err := json.Unmarshal(recorder.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Code != gocrud.RestCoder.OK() || len(r.Data) != 4 {
+		t.Errorf("unexpected readdir result %+v", r)
+	}
+}
+
+func TestServeRemoteFile(t *testing.T) {
+	wd := t.TempDir()
+	content := strings.Repeat("0123456789abcdef", 64*1024)
+	if err := os.WriteFile(path.Join(wd, "big.bin"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var locker sync.Mutex
+	gets := 0
+	handler := &webdav.Handler{FileSystem: webdav.Dir(wd), LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodGet {
+			locker.Lock()
+			gets++
+			locker.Unlock()
+		}
+		handler.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+
+	engine, db := setupTestDB(t)
+	if err := db.Create(&model.Datasource{Name: "dav", Type: model.WEBDAV, Cwd: server.URL + "/"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupDatasourceController(engine.Group("api/datasource"), db); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := request(engine, http.MethodGet, "/api/datasource/by-ds/1/big.bin", nil, nil)
+	if recorder.Body.String() != content {
+		t.Fatalf("unexpected body of %d bytes", recorder.Body.Len())
+	} else if gets != 1 {
+		t.Fatalf("expected the whole file to be fetched at once, got %d requests", gets)
+	}
+
+	recorder = request(engine, http.MethodGet, "/api/datasource/by-ds/1/big.bin", nil, http.Header{"Range": {"bytes=16-19"}})
+	if recorder.Code != http.StatusPartialContent || recorder.Body.String() != "0123" {
+		t.Fatalf("expected a part of the file, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
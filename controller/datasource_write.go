@@ -0,0 +1,369 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RenameBody struct {
+	To string `json:"to"`
+}
+
+type UploadOffset struct {
+	Offset    int64 `json:"offset"`
+	Committed bool  `json:"committed"`
+}
+
+// parseContentRange parses "bytes start-end/total", total may be "*"
+func parseContentRange(header string) (start, end, total int64, err error) {
+	total = -1
+
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, 0, fmt.Errorf("invalid content range %s", header)
+	}
+
+	var totalString string
+	_, err = fmt.Sscanf(spec, "%d-%d/%s", &start, &end, &totalString)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid content range %s", header)
+	}
+
+	if totalString != "*" {
+		if _, err := fmt.Sscanf(totalString, "%d", &total); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid content range %s", header)
+		}
+	}
+
+	if start < 0 || end < start || (total >= 0 && end >= total) {
+		return 0, 0, 0, fmt.Errorf("invalid content range %s", header)
+	}
+
+	return start, end, total, nil
+}
+
+func writeErrorCode(err error) gocrud.Code {
+	switch {
+	case errors.Is(err, model.ErrReadOnly):
+		return gocrud.RestCoder.MethodNotAllowed()
+	case errors.Is(err, fs.ErrNotExist):
+		return gocrud.RestCoder.NotFound()
+	case errors.Is(err, fs.ErrExist), errors.Is(err, model.ErrUploadOffsetMismatch), errors.Is(err, model.ErrUploadInProgress):
+		return gocrud.RestCoder.Conflict()
+	default:
+		return gocrud.RestCoder.InternalServerError()
+	}
+}
+
+// rekeyPreviews moves previews of from, and of files under from, to to
+func rekeyPreviews(db *gorm.DB, from, to model.FileKey) error {
+	var previews []model.Preview
+	err := db.Model(&model.Preview{}).
+		Where("`key` = ? OR `key` LIKE ? ESCAPE '!'", from, escapeLike(string(from))+"/%").
+		Find(&previews).Error
+	if err != nil {
+		return err
+	}
+
+	for _, preview := range previews {
+		key := to + preview.Key[len(from):]
+		if err := db.Model(&preview).Update("key", key).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setupDatasourceWriteRoutes(group *gin.RouterGroup, db *gorm.DB) {
+	// findWritable returns the datasource and the cleaned path in route param key, if current user can write to it
+	findWritable := func(context *gin.Context, key string) (*model.Datasource, model.WritableFS, string, bool) {
+		if !env.EnableWrite {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "write operations are disabled")
+			return nil, nil, "", false
+		}
+
+		name, ok := pathParam(context, key)
+		if !ok {
+			return nil, nil, "", false
+		}
+
+		var datasource model.Datasource
+		if err := db.First(&datasource, context.Param("datasource")).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return nil, nil, "", false
+		}
+
+		if !authorize(context, db, datasource.ID, name, model.ActionWrite) {
+			return nil, nil, "", false
+		}
+
+		wfs, err := model.GetWritableFS(datasource)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, writeErrorCode(err), err)
+			return nil, nil, "", false
+		}
+
+		return &datasource, wfs, name, true
+	}
+
+	// multipart upload into folder wd, every part named "file" is saved
+	group.POST("/upload/:datasource/*wd", func(context *gin.Context) {
+		datasource, wfs, wd, ok := findWritable(context, "wd")
+		if !ok {
+			return
+		}
+
+		form, err := context.MultipartForm()
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		// every name is checked before anything is written, so that a bad part does not leave half a batch
+		headers := form.File["file"]
+		names := make([]string, 0, len(headers))
+		for _, header := range headers {
+			if header.Filename == "" || header.Filename == "." || header.Filename == ".." || strings.ContainsAny(header.Filename, `/\`) {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "invalid filename "+header.Filename)
+				return
+			}
+
+			name := path.Join(wd, header.Filename)
+			if !authorize(context, db, datasource.ID, name, model.ActionWrite) {
+				return
+			}
+			names = append(names, name)
+		}
+
+		for i, header := range headers {
+			name := names[i]
+
+			file, err := header.Open()
+			if err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+				return
+			}
+
+			_, err = wfs.WriteFile(name, file)
+			_ = file.Close()
+			if err != nil {
+				l.Error().Printf("Failed to upload %s to datasource %d: %v", name, datasource.ID, err)
+				gocrud.MakeErrorResponse(context, writeErrorCode(err), err)
+				return
+			}
+
+			audit(context, db, model.AuditEvent{
+				Action:       model.AuditFileUpload,
+				DatasourceID: datasource.ID,
+				Path:         name,
+				Bytes:        header.Size,
+			})
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[[]string]{
+			Code: gocrud.RestCoder.OK(),
+			Data: names,
+		})
+	})
+
+	// offset of a resumable upload
+	group.GET("/upload/:datasource/*filename", func(context *gin.Context) {
+		datasource, _, filename, ok := findWritable(context, "filename")
+		if !ok {
+			return
+		}
+
+		offset, err := model.UploadedOffset(env.CacheFolder, *datasource, filename)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[UploadOffset]{
+			Code: gocrud.RestCoder.OK(),
+			Data: UploadOffset{Offset: offset},
+		})
+	})
+
+	// resumable chunked upload with Content-Range, or the whole file without it
+	group.PUT("/upload/:datasource/*filename", func(context *gin.Context) {
+		datasource, wfs, filename, ok := findWritable(context, "filename")
+		if !ok {
+			return
+		}
+
+		contentRange := context.GetHeader("Content-Range")
+		if contentRange == "" {
+			written, err := wfs.WriteFile(filename, context.Request.Body)
+			if err != nil {
+				gocrud.MakeErrorResponse(context, writeErrorCode(err), err)
+				return
+			}
+
+			audit(context, db, model.AuditEvent{
+				Action:       model.AuditFileUpload,
+				DatasourceID: datasource.ID,
+				Path:         filename,
+				Bytes:        written,
+			})
+
+			context.JSON(http.StatusOK, gocrud.R[UploadOffset]{
+				Code: gocrud.RestCoder.OK(),
+				Data: UploadOffset{Offset: written, Committed: true},
+			})
+			return
+		}
+
+		start, end, total, err := parseContentRange(contentRange)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		offset, err := model.AppendUploadChunk(
+			env.CacheFolder, *datasource, filename, start,
+			http.MaxBytesReader(context.Writer, context.Request.Body, end-start+1),
+		)
+		if err != nil {
+			context.AbortWithStatusJSON(http.StatusOK, gocrud.R[UploadOffset]{
+				Code:    writeErrorCode(err),
+				Message: err.Error(),
+				Data:    UploadOffset{Offset: offset},
+			})
+			return
+		}
+
+		committed := false
+		if offset == total {
+			if _, err := model.CommitUpload(env.CacheFolder, *datasource, filename); err != nil {
+				l.Error().Printf("Failed to commit upload %s to datasource %d: %v", filename, datasource.ID, err)
+				gocrud.MakeErrorResponse(context, writeErrorCode(err), err)
+				return
+			}
+			committed = true
+
+			audit(context, db, model.AuditEvent{
+				Action:       model.AuditFileUpload,
+				DatasourceID: datasource.ID,
+				Path:         filename,
+				Bytes:        total,
+				Range:        contentRange,
+			})
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[UploadOffset]{
+			Code: gocrud.RestCoder.OK(),
+			Data: UploadOffset{Offset: offset, Committed: committed},
+		})
+	})
+
+	group.POST("/mkdir/:datasource/*wd", func(context *gin.Context) {
+		datasource, wfs, wd, ok := findWritable(context, "wd")
+		if !ok {
+			return
+		}
+
+		if err := wfs.Mkdir(wd); err != nil {
+			gocrud.MakeErrorResponse(context, writeErrorCode(err), err)
+			return
+		}
+
+		audit(context, db, model.AuditEvent{
+			Action:       model.AuditFileMkdir,
+			DatasourceID: datasource.ID,
+			Path:         wd,
+		})
+
+		context.JSON(http.StatusOK, gocrud.R[bool]{
+			Code: gocrud.RestCoder.OK(),
+			Data: true,
+		})
+	})
+
+	group.POST("/rename/:datasource/*wd", func(context *gin.Context) {
+		datasource, wfs, from, ok := findWritable(context, "wd")
+		if !ok {
+			return
+		}
+
+		var body RenameBody
+		if err := context.ShouldBindJSON(&body); err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+		to, err := model.CleanPath(body.To)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		if from == "/" || to == "/" || from == to {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "invalid rename")
+			return
+		}
+
+		if !authorize(context, db, datasource.ID, to, model.ActionWrite) {
+			return
+		}
+
+		if err := wfs.Rename(from, to); err != nil {
+			gocrud.MakeErrorResponse(context, writeErrorCode(err), err)
+			return
+		}
+
+		err = rekeyPreviews(db, model.BuildPreviewKey(*datasource, from), model.BuildPreviewKey(*datasource, to))
+		if err != nil {
+			l.Error().Printf("Failed to re-key previews of %s in datasource %d: %v", from, datasource.ID, err)
+		}
+
+		audit(context, db, model.AuditEvent{
+			Action:       model.AuditFileRename,
+			DatasourceID: datasource.ID,
+			Path:         from,
+			Detail:       to,
+		})
+
+		context.JSON(http.StatusOK, gocrud.R[string]{
+			Code: gocrud.RestCoder.OK(),
+			Data: to,
+		})
+	})
+
+	group.DELETE("/remove/:datasource/*wd", func(context *gin.Context) {
+		datasource, wfs, wd, ok := findWritable(context, "wd")
+		if !ok {
+			return
+		}
+		if wd == "/" {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "can not remove root")
+			return
+		}
+
+		if err := wfs.Remove(wd); err != nil {
+			gocrud.MakeErrorResponse(context, writeErrorCode(err), err)
+			return
+		}
+
+		audit(context, db, model.AuditEvent{
+			Action:       model.AuditFileRemove,
+			DatasourceID: datasource.ID,
+			Path:         wd,
+		})
+
+		context.JSON(http.StatusOK, gocrud.R[bool]{
+			Code: gocrud.RestCoder.OK(),
+			Data: true,
+		})
+	})
+}
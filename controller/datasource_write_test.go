@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+)
+
+func TestDatasourceWrite(t *testing.T) {
+	enableWrite, cacheFolder := env.EnableWrite, env.CacheFolder
+	defer func() {
+		env.EnableWrite, env.CacheFolder = enableWrite, cacheFolder
+	}()
+
+	tmp := t.TempDir()
+	root := path.Join(tmp, "root")
+	if err := os.MkdirAll(path.Join(root, "movies"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(root, "movies", "a.mp4"), []byte("movie"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env.CacheFolder = path.Join(tmp, "cache")
+
+	engine, db := setupTestDB(t)
+	datasource := model.Datasource{Name: "local", Type: model.LOCAL, Cwd: root}
+	if err := db.Create(&datasource).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetupDatasourceController(engine.Group("api/datasource"), db); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target string, body io.Reader, header http.Header, data any) gocrud.Code {
+		return responseCode(t, request(engine, method, target, body, header), data)
+	}
+	readFile := func(name string) string {
+		content, _ := os.ReadFile(path.Join(root, name))
+		return string(content)
+	}
+
+	// every write is refused until enabled
+	env.EnableWrite = false
+	if code := send(http.MethodPut, "/api/datasource/upload/1/b.txt", strings.NewReader("b"), nil, nil); code != gocrud.RestCoder.FromStatus(http.StatusForbidden) {
+		t.Fatalf("expected upload to be forbidden while writes are disabled, got %s", code)
+	}
+	if code := send(http.MethodDelete, "/api/datasource/remove/1/movies/a.mp4", nil, nil, nil); code != gocrud.RestCoder.FromStatus(http.StatusForbidden) {
+		t.Fatalf("expected remove to be forbidden while writes are disabled, got %s", code)
+	} else if readFile("movies/a.mp4") != "movie" {
+		t.Fatalf("expected file to be kept while writes are disabled")
+	}
+	env.EnableWrite = true
+
+	// whole file without a length
+	var offset UploadOffset
+	req := io.MultiReader(strings.NewReader("hello "), strings.NewReader("world"))
+	if code := send(http.MethodPut, "/api/datasource/upload/1/b.txt", req, nil, &offset); code != gocrud.RestCoder.OK() {
+		t.Fatalf("expected whole file upload, got %s", code)
+	} else if offset.Offset != 11 || !offset.Committed {
+		t.Fatalf("expected 11 bytes written, got %+v", offset)
+	} else if readFile("b.txt") != "hello world" {
+		t.Fatalf("unexpected uploaded content %q", readFile("b.txt"))
+	}
+
+	// resumable chunks
+	for _, chunk := range []struct {
+		contentRange string
+		content      string
+		committed    bool
+	}{
+		{"bytes 0-3/8", "chun", false},
+		{"bytes 4-7/8", "ked!", true},
+	} {
+		offset = UploadOffset{}
+		code := send(http.MethodPut, "/api/datasource/upload/1/c.txt", strings.NewReader(chunk.content), http.Header{
+			"Content-Range": {chunk.contentRange},
+		}, &offset)
+		if code != gocrud.RestCoder.OK() || offset.Committed != chunk.committed {
+			t.Fatalf("%s: unexpected result %s, %+v", chunk.contentRange, code, offset)
+		}
+	}
+	if readFile("c.txt") != "chunked!" {
+		t.Fatalf("unexpected chunked content %q", readFile("c.txt"))
+	}
+
+	// multipart
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "../d.txt")
+	_, _ = part.Write([]byte("multipart"))
+	_ = writer.Close()
+	var names []string
+	code := send(http.MethodPost, "/api/datasource/upload/1/movies", &form, http.Header{
+		"Content-Type": {writer.FormDataContentType()},
+	}, &names)
+	if code != gocrud.RestCoder.OK() || len(names) != 1 || names[0] != "/movies/d.txt" {
+		t.Fatalf("expected multipart upload into the folder, got %s, %v", code, names)
+	} else if readFile("movies/d.txt") != "multipart" {
+		t.Fatalf("unexpected multipart content %q", readFile("movies/d.txt"))
+	}
+
+	// a bad name refuses the whole batch
+	for _, bad := range []string{"..", ".", `a\\b.txt`} {
+		form.Reset()
+		writer = multipart.NewWriter(&form)
+		part, _ = writer.CreateFormFile("file", "e.txt")
+		_, _ = part.Write([]byte("e"))
+		part, _ = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition": {`form-data; name="file"; filename="` + bad + `"`},
+		})
+		_, _ = part.Write([]byte("bad"))
+		_ = writer.Close()
+		if code := send(http.MethodPost, "/api/datasource/upload/1/movies", &form, http.Header{
+			"Content-Type": {writer.FormDataContentType()},
+		}, nil); code != gocrud.RestCoder.BadRequest() {
+			t.Fatalf("expected filename %q to be refused, got %s", bad, code)
+		} else if _, err := os.Stat(path.Join(root, "movies", "e.txt")); !os.IsNotExist(err) {
+			t.Fatalf("expected nothing of a refused batch to be written, got %v", err)
+		}
+	}
+
+	// previews follow renamed folders
+	for _, name := range []string{"/movies/a.mp4", "/moviesque.mp4"} {
+		if err := db.Create(&model.Preview{DatasourceID: datasource.ID, Key: model.BuildPreviewKey(datasource, name)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	rename := strings.NewReader(`{"to":"/films"}`)
+	if code := send(http.MethodPost, "/api/datasource/rename/1/movies", rename, http.Header{
+		"Content-Type": {"application/json"},
+	}, nil); code != gocrud.RestCoder.OK() {
+		t.Fatalf("expected rename, got %s", code)
+	} else if readFile("films/a.mp4") != "movie" {
+		t.Fatalf("expected folder to be renamed")
+	}
+	var keys []string
+	if err := db.Model(&model.Preview{}).Order("`id`").Pluck("key", &keys).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != string(model.BuildPreviewKey(datasource, "/films/a.mp4")) || keys[1] != string(model.BuildPreviewKey(datasource, "/moviesque.mp4")) {
+		t.Fatalf("expected only previews inside the folder to be re-keyed, got %v", keys)
+	}
+
+	// root stays
+	for _, target := range []string{"/api/datasource/remove/1/", "/api/datasource/remove/1/films/.."} {
+		if code := send(http.MethodDelete, target, nil, nil, nil); code != gocrud.RestCoder.BadRequest() {
+			t.Fatalf("expected %s to be refused, got %s", target, code)
+		}
+	}
+	if _, err := os.Stat(path.Join(root, "films", "a.mp4")); err != nil {
+		t.Fatalf("expected root to be kept: %v", err)
+	}
+
+	if code := send(http.MethodDelete, "/api/datasource/remove/1/films/a.mp4", nil, nil, nil); code != gocrud.RestCoder.OK() {
+		t.Fatalf("expected file to be removed, got %s", code)
+	} else if _, err := os.Stat(path.Join(root, "films", "a.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("expected file to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const healthConcurrency = 4
+
+func testConnectivity(datasource model.Datasource) model.ConnectivityResult {
+	return model.TestConnectivity(
+		datasource,
+		time.Duration(env.HealthTimeoutSeconds)*time.Second,
+		time.Duration(env.HealthSlowMS)*time.Millisecond,
+	)
+}
+
+// checkHealth tests datasource and stores the result on it
+func checkHealth(db *gorm.DB, datasource model.Datasource) (model.ConnectivityResult, error) {
+	result := testConnectivity(datasource)
+	health := result.Health(time.Now())
+
+	// keep updated_at for changes made by users
+	err := db.Model(&model.Datasource{}).Where("`id` = ?", datasource.ID).UpdateColumns(map[string]any{
+		"health_status":     health.Status,
+		"health_latency":    health.Latency,
+		"health_error":      health.Error,
+		"health_checked_at": health.CheckedAt,
+	}).Error
+
+	return result, err
+}
+
+// checkAllHealth checks every datasource, a few at a time
+func checkAllHealth(db *gorm.DB) {
+	var datasources []model.Datasource
+	if err := db.Find(&datasources, "`deleted_at` IS NULL").Error; err != nil {
+		l.Error().Printf("Failed to list datasources for health check: %v", err)
+		return
+	}
+
+	var waitGroup sync.WaitGroup
+	slots := make(chan struct{}, healthConcurrency)
+
+	for _, datasource := range datasources {
+		waitGroup.Add(1)
+		slots <- struct{}{}
+		go func(datasource model.Datasource) {
+			defer func() {
+				<-slots
+				waitGroup.Done()
+			}()
+
+			result, err := checkHealth(db, datasource)
+			if err != nil {
+				l.Error().Printf("Failed to store health of datasource %d: %v", datasource.ID, err)
+			} else if result.Status != model.HealthOK {
+				l.Warn().Printf("Datasource %d is %s: %s", datasource.ID, result.Status, result.Error)
+			}
+		}(datasource)
+	}
+
+	waitGroup.Wait()
+}
+
+// RunHealthChecks checks all datasources every env.HealthIntervalSeconds, it blocks and never returns if enabled
+func RunHealthChecks(db *gorm.DB) {
+	if env.HealthIntervalSeconds <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(env.HealthIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		checkAllHealth(db)
+		<-ticker.C
+	}
+}
+
+func setupDatasourceHealthRoutes(group *gin.RouterGroup, db *gorm.DB) {
+	// test tries the settings in body without saving them, credentials omitted are taken from the stored datasource
+	group.POST("/test", func(context *gin.Context) {
+		var record model.Datasource
+		if err := context.ShouldBindJSON(&record); err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		moveCwdCredentials(&record, context, db)
+		if context.IsAborted() {
+			return
+		}
+
+		if !authorizeDatasourceSave(&record, context, db) {
+			return
+		}
+
+		sealCredentials(&record, context, db)
+		if context.IsAborted() {
+			return
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[model.ConnectivityResult]{
+			Code: gocrud.RestCoder.OK(),
+			Data: testConnectivity(record),
+		})
+	})
+
+	// check tests the stored datasource now and updates its health
+	group.POST("/check/:datasource", func(context *gin.Context) {
+		id, err := strconv.ParseUint(context.Param("datasource"), 10, 64)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		var datasource model.Datasource
+		if err := db.First(&datasource, id).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		}
+
+		if !authorize(context, db, datasource.ID, "/", model.ActionRead) {
+			return
+		}
+
+		result, err := checkHealth(db, datasource)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[model.ConnectivityResult]{
+			Code: gocrud.RestCoder.OK(),
+			Data: result,
+		})
+	})
+}
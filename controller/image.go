@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/assets"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+	"github.com/allape/goview/util"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func resizeOptionsFromQuery(context *gin.Context) (*model.ResizeOptions, error) {
+	atoi := func(key string) (int, error) {
+		value := context.Query(key)
+		if value == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(value)
+	}
+
+	width, err := atoi("w")
+	if err != nil {
+		return nil, err
+	}
+	height, err := atoi("h")
+	if err != nil {
+		return nil, err
+	}
+	quality, err := atoi("q")
+	if err != nil {
+		return nil, err
+	}
+
+	options := &model.ResizeOptions{
+		Width:   width,
+		Height:  height,
+		Fit:     util.ImageFit(strings.ToLower(context.Query("fit"))),
+		Format:  model.ImageFormat(strings.ToLower(context.Query("format"))),
+		Quality: quality,
+	}
+
+	err = options.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+func serveResizedImage(context *gin.Context, options *model.ResizeOptions, file string) {
+	context.Header("Content-Type", options.MIME())
+	context.Header("Cache-Control", "public, max-age=86400")
+	context.File(file)
+}
+
+func SetupImageController(group *gin.RouterGroup, db *gorm.DB) error {
+	group.GET("/by-ds/:datasource/*filename", limitStreams(datasourceOfParams), func(context *gin.Context) {
+		datasourceId := context.Param("datasource")
+		filename, ok := pathParam(context, "filename")
+		if !ok {
+			return
+		}
+
+		options, err := resizeOptionsFromQuery(context)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		var datasource model.Datasource
+		if err := db.Model(&datasource).First(&datasource, datasourceId).Error; err != nil {
+			context.Header("Cache-Control", "no-cache")
+			context.Data(http.StatusNotFound, assets.MIMEType, assets.IV404)
+			return
+		}
+
+		if !can(context, db, datasource.ID, filename, model.ActionRead) {
+			redir(context, http.StatusNotFound)
+			return
+		}
+
+		datasource = model.ResolveDatasource(datasource, filename)
+
+		file, err := model.ResizeImageFromDatasource(datasource, filename, env.CacheFolder, *options)
+		if errors.Is(err, fs.ErrNotExist) {
+			redir(context, http.StatusNotFound)
+			return
+		} else if err != nil {
+			l.Error().Printf("Failed to resize %s from datasource %d: %v", filename, datasource.ID, err)
+			redir(context, http.StatusInternalServerError)
+			return
+		}
+
+		serveResizedImage(context, options, file)
+	})
+
+	group.GET("/by-key/*key", func(context *gin.Context) {
+		key := model.FileKey(strings.TrimPrefix(strings.TrimSpace(context.Param("key")), "/"))
+
+		options, err := resizeOptionsFromQuery(context)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		if !canKey(context, db, key, model.ActionRead) {
+			redir(context, http.StatusNotFound)
+			return
+		}
+
+		var preview model.Preview
+		if err := db.Model(&preview).First(&preview, "`key` = ?", key).Error; err != nil {
+			redir(context, http.StatusNotFound)
+			return
+		}
+
+		cover := path.Join(env.PreviewFolder, preview.Cover)
+		stat, err := os.Stat(cover)
+		if err != nil || stat.IsDir() {
+			redir(context, http.StatusNotFound)
+			return
+		}
+
+		file, err := model.ResizeImage(cover, model.CoverVersionDigest(preview, stat), env.CacheFolder, *options)
+		if err != nil {
+			l.Error().Printf("Failed to resize cover of %s: %v", key, err)
+			redir(context, http.StatusInternalServerError)
+			return
+		}
+
+		serveResizedImage(context, options, file)
+	})
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+)
+
+func TestResizeImage(t *testing.T) {
+	cacheFolder, previewFolder := env.CacheFolder, env.PreviewFolder
+	defer func() {
+		env.CacheFolder, env.PreviewFolder = cacheFolder, previewFolder
+	}()
+
+	tmp := t.TempDir()
+	root := path.Join(tmp, "root")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(root, "a.jpg"), []byte("not really a jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env.CacheFolder = path.Join(tmp, "cache")
+	env.PreviewFolder = path.Join(tmp, "preview")
+
+	engine, db := setupTestDB(t)
+	datasource := model.Datasource{Name: "local", Type: model.LOCAL, Cwd: root}
+	if err := db.Create(&datasource).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetupImageController(engine.Group("api/image"), db); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		return request(engine, http.MethodGet, target, nil, nil)
+	}
+
+	if code := responseCode(t, get("/api/image/by-ds/1/a.jpg?w=5000"), nil); code != gocrud.RestCoder.BadRequest() {
+		t.Fatalf("expected oversized width to be rejected, got %s", code)
+	}
+
+	if recorder := get("/api/image/by-ds/2/a.jpg"); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected missing datasource to be 404, got %d", recorder.Code)
+	}
+	if recorder := get("/api/image/by-ds/1/missing.jpg"); recorder.Header().Get("Location") != URI404 {
+		t.Fatalf("expected missing file to redirect to 404, got %d %s", recorder.Code, recorder.Header().Get("Location"))
+	}
+
+	// a cached version is served without downloading the source again
+	options := model.ResizeOptions{Width: 64}
+	if err := options.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	cached := func() string {
+		dfs, err := model.GetFS(datasource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat, err := dfs.Stat("/a.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path.Join(env.CacheFolder, options.CacheFile(model.FileVersionDigest(datasource, "/a.jpg", stat)))
+	}
+
+	hit := cached()
+	if err := os.MkdirAll(path.Dir(hit), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hit, []byte("resized"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := get("/api/image/by-ds/1/a.jpg?w=64")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "resized" {
+		t.Fatalf("expected cached image, got %d %q", recorder.Code, recorder.Body.String())
+	} else if recorder.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("unexpected content type %s", recorder.Header().Get("Content-Type"))
+	}
+
+	// a modified source is resized again
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path.Join(root, "a.jpg"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if cached() == hit {
+		t.Fatalf("expected cache key to change with mtime")
+	}
+	// which is not a real jpeg
+	recorder = get("/api/image/by-ds/1/a.jpg?w=64")
+	if recorder.Body.String() == "resized" || recorder.Header().Get("Location") != URI500 {
+		t.Fatalf("expected stale cache not to be served, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// a replaced cover is resized again
+	preview := model.Preview{DatasourceID: datasource.ID, Key: model.BuildPreviewKey(datasource, "/a.mp4"), Digest: "digest", Cover: "a.jpg"}
+	if err := db.Create(&preview).Error; err != nil {
+		t.Fatal(err)
+	}
+	cover := path.Join(env.PreviewFolder, preview.Cover)
+	if err := os.MkdirAll(env.PreviewFolder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cover, []byte("not a jpeg either"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	coverCache := func() string {
+		stat, err := os.Stat(cover)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path.Join(env.CacheFolder, options.CacheFile(model.CoverVersionDigest(preview, stat)))
+	}
+
+	hit = coverCache()
+	if err := os.MkdirAll(path.Dir(hit), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hit, []byte("resized cover"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if body := get("/api/image/by-key/" + string(preview.Key) + "?w=64").Body.String(); body != "resized cover" {
+		t.Fatalf("expected cached cover, got %q", body)
+	}
+
+	if err := os.Chtimes(cover, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if coverCache() == hit {
+		t.Fatalf("expected cover cache key to change with mtime")
+	}
+	if recorder := get("/api/image/by-key/" + string(preview.Key) + "?w=64"); recorder.Body.String() == "resized cover" {
+		t.Fatalf("expected stale cover not to be served")
+	}
+}
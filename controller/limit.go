@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/env"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// clientKey identifies who sent the request, signed-in users share one budget across ips
+func clientKey(context *gin.Context) string {
+	if user := CurrentUser(context); user != nil {
+		return "user:" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+	return "ip:" + context.ClientIP()
+}
+
+func tooManyRequests(context *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	context.Header("Retry-After", strconv.Itoa(seconds))
+	context.AbortWithStatusJSON(http.StatusTooManyRequests, gocrud.R[any]{
+		Code:    gocrud.RestCoder.FromStatus(http.StatusTooManyRequests),
+		Message: message,
+	})
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket per client, refilled at rate tokens per second up to burst
+type rateLimiter struct {
+	sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   math.Max(float64(burst), 1),
+		buckets: map[string]*bucket{},
+	}
+}
+
+// take consumes a token of key, or returns how long to wait for the next one
+func (r *rateLimiter) take(key string, now time.Time) (bool, time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.sweep(now)
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{tokens: r.burst, last: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens = math.Min(r.burst, b.tokens+now.Sub(b.last).Seconds()*r.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / r.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets buckets that have been refilled completely, they are the same as new ones
+func (r *rateLimiter) sweep(now time.Time) {
+	if now.Sub(r.swept) < time.Minute {
+		return
+	}
+	r.swept = now
+
+	full := time.Duration(r.burst / r.rate * float64(time.Second))
+	for key, b := range r.buckets {
+		if now.Sub(b.last) >= full {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// NewRateLimitMiddleware rejects clients exceeding env.RateLimit with 429,
+// mount it after auth so that users are told apart from their ips
+func NewRateLimitMiddleware() gin.HandlerFunc {
+	if env.RateLimit <= 0 {
+		return func(context *gin.Context) {
+			context.Next()
+		}
+	}
+
+	limiter := newRateLimiter(env.RateLimit, env.RateBurst)
+
+	return func(context *gin.Context) {
+		if ok, retryAfter := limiter.take(clientKey(context), time.Now()); !ok {
+			tooManyRequests(context, retryAfter, "too many requests")
+			return
+		}
+		context.Next()
+	}
+}
+
+// NewLoginRateLimitMiddleware rejects ips exceeding env.LoginRateLimit with 429,
+// a budget of its own and much smaller than env.RateLimit, to slow down guessing passwords
+func NewLoginRateLimitMiddleware() gin.HandlerFunc {
+	if env.LoginRateLimit <= 0 {
+		return func(context *gin.Context) {
+			context.Next()
+		}
+	}
+
+	limiter := newRateLimiter(env.LoginRateLimit, env.LoginRateBurst)
+
+	return func(context *gin.Context) {
+		if ok, retryAfter := limiter.take("ip:"+context.ClientIP(), time.Now()); !ok {
+			tooManyRequests(context, retryAfter, "too many login attempts")
+			return
+		}
+		context.Next()
+	}
+}
+
+// streamLimiter counts the streams in flight per client per datasource
+type streamLimiter struct {
+	sync.Mutex
+	max     int
+	streams map[string]int
+}
+
+func (s *streamLimiter) acquire(key string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.streams[key] >= s.max {
+		return false
+	}
+	s.streams[key]++
+	return true
+}
+
+func (s *streamLimiter) release(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.streams[key]--; s.streams[key] <= 0 {
+		delete(s.streams, key)
+	}
+}
+
+var streams = &streamLimiter{
+	max:     env.StreamLimit,
+	streams: map[string]int{},
+}
+
+// datasourceResolver finds the datasource a request streams from, 0 if unknown
+type datasourceResolver func(context *gin.Context) gocrud.ID
+
+// datasourceOfParams reads route param datasource, or the datasource in route param key
+func datasourceOfParams(context *gin.Context) gocrud.ID {
+	if datasourceId := context.Param("datasource"); datasourceId != "" {
+		id, err := strconv.ParseUint(datasourceId, 10, 64)
+		if err != nil {
+			return 0
+		}
+		return gocrud.ID(id)
+	}
+
+	id, _ := model.FileKey(strings.TrimPrefix(context.Param("key"), "/")).Split()
+	return id
+}
+
+// datasourceOfShare reads the datasource of share link in route param token
+func datasourceOfShare(db *gorm.DB) datasourceResolver {
+	return func(context *gin.Context) gocrud.ID {
+		var share model.Share
+		err := db.Select("datasource_id").
+			First(&share, "`token` = ? AND `deleted_at` IS NULL", model.HashToken(context.Param("token"))).Error
+		if err != nil {
+			return 0
+		}
+		return share.DatasourceID
+	}
+}
+
+// limitStreams caps the concurrent streams of a client from one datasource to env.StreamLimit,
+// requests with an unknown datasource are left to the handler to reject
+func limitStreams(resolve datasourceResolver) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		id := resolve(context)
+		if id == 0 || streams.max <= 0 {
+			context.Next()
+			return
+		}
+
+		key := clientKey(context) + "@" + strconv.FormatUint(uint64(id), 10)
+		if !streams.acquire(key) {
+			tooManyRequests(context, time.Second, "too many concurrent streams")
+			return
+		}
+		defer streams.release(key)
+
+		context.Next()
+	}
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/allape/goview/env"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.take("a", now); !ok {
+			t.Fatalf("request %d should fit in the burst", i)
+		}
+	}
+
+	ok, retryAfter := limiter.take("a", now)
+	if ok {
+		t.Fatalf("request beyond the burst should be rejected")
+	} else if retryAfter != 500*time.Millisecond {
+		t.Fatalf("expected to retry after 500ms, got %s", retryAfter)
+	}
+
+	if ok, _ := limiter.take("b", now); !ok {
+		t.Fatalf("clients should not share a bucket")
+	}
+
+	if ok, _ := limiter.take("a", now.Add(retryAfter)); !ok {
+		t.Fatalf("request should be allowed once refilled")
+	}
+
+	limiter.take("b", now.Add(2*time.Minute))
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Fatalf("full buckets should be swept")
+	}
+}
+
+func TestLimitStreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limit := streams.max
+	streams.max = 1
+	defer func() {
+		streams.max = limit
+	}()
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+
+	engine := gin.New()
+	engine.GET("/by-ds/:datasource/*wd", limitStreams(datasourceOfParams), func(context *gin.Context) {
+		if context.Query("block") != "" {
+			started <- struct{}{}
+			<-done
+		}
+		context.Status(http.StatusOK)
+	})
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+
+	finished := make(chan int)
+	go func() {
+		finished <- serve("/by-ds/1/a.mp4?block=1").Code
+	}()
+	<-started
+
+	recorder := serve("/by-ds/1/b.mp4")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while a stream is in flight, got %d", recorder.Code)
+	} else if recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After")
+	}
+
+	if code := serve("/by-ds/2/b.mp4").Code; code != http.StatusOK {
+		t.Fatalf("other datasources should not be capped, got %d", code)
+	}
+
+	close(done)
+	if code := <-finished; code != http.StatusOK {
+		t.Fatalf("expected the blocked stream to finish, got %d", code)
+	}
+
+	if code := serve("/by-ds/1/b.mp4").Code; code != http.StatusOK {
+		t.Fatalf("expected the stream to be released, got %d", code)
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limit, burst := env.LoginRateLimit, env.LoginRateBurst
+	env.LoginRateLimit, env.LoginRateBurst = 0.01, 2
+	defer func() {
+		env.LoginRateLimit, env.LoginRateBurst = limit, burst
+	}()
+
+	engine := gin.New()
+	engine.POST("/login", NewLoginRateLimitMiddleware(), func(context *gin.Context) {
+		context.Status(http.StatusOK)
+	})
+
+	login := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = ip + ":12345"
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := login("10.0.0.1").Code; code != http.StatusOK {
+			t.Fatalf("attempt %d should fit in the burst, got %d", i, code)
+		}
+	}
+
+	recorder := login("10.0.0.1")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 beyond the burst, got %d", recorder.Code)
+	} else if recorder.Header().Get("Retry-After") != "100" {
+		t.Fatalf("expected to retry after 100s, got %s", recorder.Header().Get("Retry-After"))
+	}
+
+	if code := login("10.0.0.2").Code; code != http.StatusOK {
+		t.Fatalf("other ips should not be limited, got %d", code)
+	}
+}
@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -21,6 +23,8 @@ const (
 	URINoPreview = "/api/preview/no-preview"
 )
 
+const previewContextKey = "goview.preview"
+
 func redir(context *gin.Context, code int) {
 	image := URINoPreview
 
@@ -35,7 +39,25 @@ func redir(context *gin.Context, code int) {
 	context.Redirect(http.StatusFound, image)
 }
 
+type previewFilePicker func(preview model.Preview) string
+
+func pickCover(preview model.Preview) string {
+	return preview.Cover
+}
+
+// pickPoster falls back to cover for previews without a poster, e.g. images
+func pickPoster(preview model.Preview) string {
+	if preview.Poster == "" {
+		return preview.Cover
+	}
+	return preview.Poster
+}
+
 func servePreviewByKey(context *gin.Context, db *gorm.DB, key model.FileKey) {
+	servePreviewFileByKey(context, db, key, pickCover)
+}
+
+func servePreviewFileByKey(context *gin.Context, db *gorm.DB, key model.FileKey, picker previewFilePicker) {
 	key = model.FileKey(strings.TrimSpace(string(key)))
 	if key == "" {
 		redir(context, http.StatusNotFound)
@@ -50,7 +72,13 @@ func servePreviewByKey(context *gin.Context, db *gorm.DB, key model.FileKey) {
 		return
 	}
 
-	cover := path.Join(env.PreviewFolder, preview.Cover)
+	// cover and poster are relative to the preview folder, never outside it
+	name, err := model.CleanPath(picker(preview))
+	if err != nil {
+		redir(context, http.StatusNotFound)
+		return
+	}
+	cover := path.Join(env.PreviewFolder, name)
 
 	stat, err := os.Stat(cover)
 	if err != nil {
@@ -80,7 +108,56 @@ func SetupPreviewController(group *gin.RouterGroup, db *gorm.DB) error {
 			"in_id":            gocrud.KeywordIn("id", nil),
 			"in_key":           gocrud.KeywordIn("key", nil),
 		},
+		// previews of hidden datasources or folders must not leak through key
+		WillCount: scopePreviews,
+		WillPage: func(pageNum *int64, pageSize *int64, context *gin.Context, db *gorm.DB) *gorm.DB {
+			return scopePreviews(context, db)
+		},
+		DidGetOne: func(record *model.Preview, context *gin.Context, db *gorm.DB) {
+			if !canKey(context, db, record.Key, model.ActionRead) {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), "record not found")
+			}
+		},
+		// previews are generated through from-ds, editing the rows directly is for admins only
+		WillSave: func(record *model.Preview, context *gin.Context, db *gorm.DB) {
+			acl, err := aclOf(context, db)
+			if err != nil || !acl.IsAdmin() {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "admin only")
+				return
+			}
+
+			// files in the preview folder are managed by the server only
+			record.Cover, record.Poster = "", ""
+			if record.ID != 0 {
+				var existing model.Preview
+				if err := db.First(&existing, record.ID).Error; err != nil {
+					gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+					return
+				}
+				record.Cover, record.Poster = existing.Cover, existing.Poster
+			}
+		},
+		WillDelete: func(context *gin.Context, db *gorm.DB) {
+			var preview model.Preview
+			if err := db.First(&preview, context.Param("id")).Error; err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+				return
+			}
+			if !canKey(context, db, preview.Key, model.ActionGenerate) {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "permission denied")
+				return
+			}
+			context.Set(previewContextKey, &preview)
+		},
 		OnDelete: gocrud.NewSoftDeleteHandler[model.Preview](gocrud.RestCoder),
+		DidDelete: func(context *gin.Context, db *gorm.DB) {
+			event := model.AuditEvent{Action: model.AuditPreviewDelete}
+			if preview, ok := context.Get(previewContextKey); ok {
+				event.DatasourceID = preview.(*model.Preview).DatasourceID
+				event.Detail = string(preview.(*model.Preview).Key)
+			}
+			audit(context, db, event)
+		},
 	})
 
 	if err != nil {
@@ -94,7 +171,10 @@ func SetupPreviewController(group *gin.RouterGroup, db *gorm.DB) error {
 		defer locker.Unlock()
 
 		datasourceId := context.Param("datasource")
-		filename := context.Param("filename")
+		filename, ok := pathParam(context, "filename")
+		if !ok {
+			return
+		}
 
 		var datasource model.Datasource
 		if err := db.Model(&datasource).First(&datasource, datasourceId).Error; err != nil {
@@ -102,6 +182,11 @@ func SetupPreviewController(group *gin.RouterGroup, db *gorm.DB) error {
 			return
 		}
 
+		if !authorize(context, db, datasource.ID, filename, model.ActionGenerate) {
+			return
+		}
+
+		datasource = model.ResolveDatasource(datasource, filename)
 		key := model.BuildPreviewKey(datasource, filename)
 
 		var found model.Preview
@@ -128,6 +213,13 @@ func SetupPreviewController(group *gin.RouterGroup, db *gorm.DB) error {
 			return
 		}
 
+		audit(context, db, model.AuditEvent{
+			Action:       model.AuditPreviewGenerate,
+			DatasourceID: datasource.ID,
+			Path:         filename,
+			Detail:       string(preview.Key),
+		})
+
 		context.JSON(http.StatusOK, gocrud.R[model.Preview]{
 			Code: gocrud.RestCoder.OK(),
 			Data: *preview,
@@ -136,7 +228,10 @@ func SetupPreviewController(group *gin.RouterGroup, db *gorm.DB) error {
 
 	group.GET("/by-ds/:datasource/*filename", func(context *gin.Context) {
 		datasourceId := context.Param("datasource")
-		filename := context.Param("filename")
+		filename, ok := pathParam(context, "filename")
+		if !ok {
+			return
+		}
 
 		var datasource model.Datasource
 		if err := db.Model(&datasource).First(&datasource, datasourceId).Error; err != nil {
@@ -145,14 +240,95 @@ func SetupPreviewController(group *gin.RouterGroup, db *gorm.DB) error {
 			return
 		}
 
-		key := model.BuildPreviewKey(datasource, filename)
+		if !can(context, db, datasource.ID, filename, model.ActionRead) {
+			redir(context, http.StatusNotFound)
+			return
+		}
+
+		key := model.BuildPreviewKey(model.ResolveDatasource(datasource, filename), filename)
 
 		servePreviewByKey(context, db, key)
 	})
 
 	group.GET("/by-key/*key", func(context *gin.Context) {
-		key := context.Param("key")
-		servePreviewByKey(context, db, model.FileKey(key))
+		key := model.FileKey(context.Param("key"))
+		if !canKey(context, db, key, model.ActionRead) {
+			redir(context, http.StatusNotFound)
+			return
+		}
+		servePreviewByKey(context, db, key)
+	})
+
+	group.GET("/poster/by-ds/:datasource/*filename", func(context *gin.Context) {
+		datasourceId := context.Param("datasource")
+		filename, ok := pathParam(context, "filename")
+		if !ok {
+			return
+		}
+
+		var datasource model.Datasource
+		if err := db.Model(&datasource).First(&datasource, datasourceId).Error; err != nil {
+			context.Header("Cache-Control", "no-cache")
+			context.Data(http.StatusNotFound, assets.MIMEType, assets.IV404)
+			return
+		}
+
+		if !can(context, db, datasource.ID, filename, model.ActionRead) {
+			redir(context, http.StatusNotFound)
+			return
+		}
+
+		key := model.BuildPreviewKey(model.ResolveDatasource(datasource, filename), filename)
+
+		servePreviewFileByKey(context, db, key, pickPoster)
+	})
+
+	group.GET("/poster/by-key/*key", func(context *gin.Context) {
+		key := model.FileKey(context.Param("key"))
+		if !canKey(context, db, key, model.ActionRead) {
+			redir(context, http.StatusNotFound)
+			return
+		}
+		servePreviewFileByKey(context, db, key, pickPoster)
+	})
+
+	group.GET("/subtitle/:id/:nth", func(context *gin.Context) {
+		id := context.Param("id")
+
+		nth, err := strconv.Atoi(strings.TrimSuffix(context.Param("nth"), ".vtt"))
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		var preview model.Preview
+		if err := db.Model(&preview).First(&preview, id).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		}
+
+		if !canKey(context, db, preview.Key, model.ActionRead) {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), "record not found")
+			return
+		}
+
+		var datasource model.Datasource
+		if err := db.Model(&datasource).First(&datasource, preview.DatasourceID).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		}
+
+		vtt, err := model.SubtitleToWebVTT(datasource, preview, nth, env.CacheFolder)
+		if errors.Is(err, model.ErrSubtitleNotFound) {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		} else if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		context.Header("Content-Type", "text/vtt; charset=utf-8")
+		context.File(vtt)
 	})
 
 	group.GET("/404", func(context *gin.Context) {
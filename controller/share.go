@@ -0,0 +1,450 @@
+package controller
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	ShareCookiePrefix   = "goview_share_"
+	SharePasswordHeader = "X-Share-Password"
+)
+
+type ShareBody struct {
+	Scope          model.ShareScope `json:"scope"`
+	Password       string           `json:"password"`
+	ExpiresInHours int64            `json:"expiresInHours"` // 0 for never
+	MaxDownloads   int64            `json:"maxDownloads"`
+}
+
+type ShareResult struct {
+	Token string      `json:"token"`
+	Share model.Share `json:"share"`
+}
+
+type UnlockBody struct {
+	Password string `json:"password"`
+}
+
+type ShareInfo struct {
+	Name      string           `json:"name"`
+	IsDir     bool             `json:"isDir"`
+	Scope     model.ShareScope `json:"scope"`
+	Protected bool             `json:"protected"`
+	ExpiresAt *time.Time       `json:"expiresAt"`
+}
+
+// SetupShareController creates share links for anyone who can read the path, only admins list and revoke them
+func SetupShareController(group *gin.RouterGroup, db *gorm.DB) error {
+	err := gocrud.New(group.Group("", RequireAdmin), db, gocrud.Crud[model.Share]{
+		EnableGetAll: true,
+		DisableSave:  true,
+		SearchHandlers: map[string]gocrud.SearchHandler{
+			"datasourceId":     gocrud.KeywordEqual("datasource_id", nil),
+			"path":             gocrud.KeywordLike("path", nil),
+			"createdBy":        gocrud.KeywordEqual("created_by", nil),
+			"deleted":          gocrud.NewSoftDeleteSearchHandler(""),
+			"sortBy_createdAt": gocrud.SortBy("created_at"),
+		},
+		OnDelete: gocrud.NewSoftDeleteHandler[model.Share](gocrud.RestCoder),
+	})
+	if err != nil {
+		return err
+	}
+
+	group.POST("/create/:datasource/*wd", func(context *gin.Context) {
+		wd, ok := pathParam(context, "wd")
+		if !ok {
+			return
+		}
+
+		var body ShareBody
+		if err := context.ShouldBindJSON(&body); err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+		if body.ExpiresInHours < 0 || body.MaxDownloads < 0 {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "invalid expiry or download limit")
+			return
+		}
+
+		var datasource model.Datasource
+		if err := db.First(&datasource, context.Param("datasource")).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		}
+
+		if !authorize(context, db, datasource.ID, wd, model.ActionRead) {
+			return
+		}
+
+		dfs, err := model.GetFS(datasource)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		stat, err := dfs.Stat(wd)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		}
+
+		token, share, err := model.NewShare(datasource.ID, wd, stat.IsDir(), body.Scope, body.Password)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		share.MaxDownloads = body.MaxDownloads
+		if body.ExpiresInHours > 0 {
+			expiresAt := time.Now().Add(time.Duration(body.ExpiresInHours) * time.Hour)
+			share.ExpiresAt = &expiresAt
+		}
+		if user := CurrentUser(context); user != nil {
+			share.CreatedBy = user.ID
+		}
+
+		if err := db.Create(share).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		context.Set(shareContextKey, share)
+		audit(context, db, model.AuditEvent{
+			Action:       model.AuditShareCreate,
+			DatasourceID: share.DatasourceID,
+			Path:         share.Path,
+			Detail:       string(share.Scope),
+		})
+
+		context.JSON(http.StatusOK, gocrud.R[ShareResult]{
+			Code: gocrud.RestCoder.OK(),
+			Data: ShareResult{Token: token, Share: *share},
+		})
+	})
+
+	return nil
+}
+
+// findShare looks up the share of route param token,
+// protected shares need the password in header or the cookie from unlock
+func findShare(context *gin.Context, db *gorm.DB, unlocked bool) (*model.Share, bool) {
+	token := context.Param("token")
+
+	var share model.Share
+	if err := db.First(&share, "`token` = ? AND `deleted_at` IS NULL", model.HashToken(token)).Error; err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), "share link not found")
+		return nil, false
+	}
+
+	if share.Expired(time.Now()) {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusGone), model.ErrShareExpired)
+		return nil, false
+	}
+
+	if unlocked && share.Protected {
+		cookie, _ := context.Cookie(ShareCookiePrefix + strconv.FormatUint(uint64(share.ID), 10))
+		if cookie != share.Unlocker(token) && !share.CheckPassword(context.GetHeader(SharePasswordHeader)) {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusUnauthorized), "password required")
+			return nil, false
+		}
+	}
+
+	return &share, true
+}
+
+// shareTarget returns the share, its datasource and the path in datasource of route param wd
+func shareTarget(context *gin.Context, db *gorm.DB) (*model.Share, *model.Datasource, string, bool) {
+	share, ok := findShare(context, db, true)
+	if !ok {
+		return nil, nil, "", false
+	}
+
+	file, err := share.Resolve(context.Param("wd"))
+	if err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+		return nil, nil, "", false
+	}
+
+	var datasource model.Datasource
+	if err := db.First(&datasource, share.DatasourceID).Error; err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+		return nil, nil, "", false
+	}
+
+	// events audited from here on are attributed to the share
+	context.Set(shareContextKey, share)
+
+	return share, &datasource, file, true
+}
+
+// consumeDownload counts a download, false if the limit is reached
+func consumeDownload(db *gorm.DB, share *model.Share) (bool, error) {
+	result := db.Model(&model.Share{}).
+		Where("`id` = ? AND (`max_downloads` = 0 OR `downloads` < `max_downloads`)", share.ID).
+		Update("downloads", gorm.Expr("`downloads` + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// downloadable checks the scope and the download limit of share
+func downloadable(context *gin.Context, db *gorm.DB, share *model.Share) bool {
+	if share.Scope != model.ShareDownload {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "download is not allowed")
+		return false
+	}
+	return countDownload(context, db, share)
+}
+
+// countDownload responds with gone once the download limit of share is reached
+func countDownload(context *gin.Context, db *gorm.DB, share *model.Share) bool {
+	ok, err := consumeDownload(db, share)
+	if err != nil {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+		return false
+	} else if !ok {
+		gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusGone), model.ErrShareDownloadsOut)
+		return false
+	}
+
+	return true
+}
+
+// partialRange reports whether a request with these headers gets a part of a file of size, rather than all of it
+func partialRange(header, ifRange string, size int64) bool {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	// several ranges may add up to the whole file, and an If-Range that does not match gets all of it
+	if !ok || ifRange != "" || strings.Contains(spec, ",") {
+		return false
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return false
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		return err == nil && suffix < size
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return false
+	} else if start > 0 {
+		return true
+	} else if last == "" {
+		return false
+	}
+
+	end, err := strconv.ParseInt(last, 10, 64)
+	return err == nil && end < size-1
+}
+
+// SetupPublicShareController resolves share links, it must be mounted without auth
+func SetupPublicShareController(group *gin.RouterGroup, db *gorm.DB) error {
+	group.GET("/:token", func(context *gin.Context) {
+		share, ok := findShare(context, db, false)
+		if !ok {
+			return
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[ShareInfo]{
+			Code: gocrud.RestCoder.OK(),
+			Data: ShareInfo{
+				Name:      path.Base(share.Path),
+				IsDir:     share.IsDir,
+				Scope:     share.Scope,
+				Protected: share.Protected,
+				ExpiresAt: share.ExpiresAt,
+			},
+		})
+	})
+
+	group.POST("/:token/unlock", func(context *gin.Context) {
+		share, ok := findShare(context, db, false)
+		if !ok {
+			return
+		}
+
+		var body UnlockBody
+		if err := context.ShouldBindJSON(&body); err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		context.Set(shareContextKey, share)
+		if !share.CheckPassword(body.Password) {
+			audit(context, db, model.AuditEvent{
+				Action:       model.AuditShareUnlock,
+				DatasourceID: share.DatasourceID,
+				Path:         share.Path,
+				Detail:       "wrong password",
+			})
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusUnauthorized), "wrong password")
+			return
+		}
+
+		audit(context, db, model.AuditEvent{
+			Action:       model.AuditShareUnlock,
+			DatasourceID: share.DatasourceID,
+			Path:         share.Path,
+		})
+
+		maxAge := 0
+		if share.ExpiresAt != nil {
+			maxAge = int(time.Until(*share.ExpiresAt).Seconds())
+		}
+
+		secure := context.Request.TLS != nil || context.GetHeader("X-Forwarded-Proto") == "https"
+		context.SetSameSite(http.SameSiteLaxMode)
+		context.SetCookie(
+			ShareCookiePrefix+strconv.FormatUint(uint64(share.ID), 10),
+			share.Unlocker(context.Param("token")),
+			maxAge, "/", "", secure, true,
+		)
+
+		context.JSON(http.StatusOK, gocrud.R[bool]{
+			Code: gocrud.RestCoder.OK(),
+			Data: true,
+		})
+	})
+
+	group.GET("/:token/readdir/*wd", func(context *gin.Context) {
+		share, datasource, wd, ok := shareTarget(context, db)
+		if !ok {
+			return
+		} else if !share.IsDir {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "not a folder")
+			return
+		}
+
+		dfs, err := model.GetFS(*datasource)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		entries, err := dfs.ReadDir(wd)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		files, err := fileInfos(db, *datasource, wd, entries)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		// keys reveal where the share is in datasource
+		for i := range files {
+			files[i].Key = ""
+		}
+
+		audit(context, db, model.AuditEvent{
+			Action:       model.AuditShareReadDir,
+			DatasourceID: datasource.ID,
+			Path:         wd,
+		})
+
+		context.JSON(http.StatusOK, gocrud.R[[]FileInfo]{
+			Code: gocrud.RestCoder.OK(),
+			Data: files,
+		})
+	})
+
+	// file streams inline, ?download=1 downloads as attachment.
+	// Responses with the whole file count towards the limit, parts of a stream do not.
+	// Anything but a part of the file is a download, which the preview scope does not allow.
+	group.GET("/:token/file/*wd", limitStreams(datasourceOfShare(db)), func(context *gin.Context) {
+		share, datasource, file, ok := shareTarget(context, db)
+		if !ok {
+			return
+		}
+
+		_, download := context.GetQuery("download")
+		if download || context.GetHeader("Range") == "" {
+			if share.Scope != model.ShareDownload {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "download is not allowed")
+				return
+			}
+		}
+		if download {
+			context.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(file)}))
+		}
+
+		serveFile(context, db, datasource.ID, file, func(stat fs.FileInfo, seekable bool) bool {
+			if seekable && partialRange(context.GetHeader("Range"), context.GetHeader("If-Range"), stat.Size()) {
+				return true
+			} else if share.Scope != model.ShareDownload {
+				// e.g. bytes=0-, or any range of a source that can not seek
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "download is not allowed")
+				return false
+			}
+			return countDownload(context, db, share)
+		})
+	})
+
+	group.GET("/:token/zip/*wd", limitStreams(datasourceOfShare(db)), func(context *gin.Context) {
+		share, datasource, wd, ok := shareTarget(context, db)
+		if !ok {
+			return
+		} else if !share.IsDir {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "not a folder")
+			return
+		}
+
+		dfs, err := model.GetFS(*datasource)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		if stat, err := dfs.Stat(wd); err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			return
+		} else if !stat.IsDir() {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "not a folder")
+			return
+		}
+
+		if !downloadable(context, db, share) {
+			return
+		}
+
+		filename := path.Base(wd)
+		if wd == "/" {
+			filename = datasource.Name
+		}
+
+		serveZip(context, db, dfs, datasource.ID, wd, context.QueryArray("path"), filename)
+	})
+
+	servePreview := func(picker previewFilePicker) gin.HandlerFunc {
+		return func(context *gin.Context) {
+			_, datasource, file, ok := shareTarget(context, db)
+			if !ok {
+				return
+			}
+
+			key := model.BuildPreviewKey(model.ResolveDatasource(*datasource, file), file)
+			servePreviewFileByKey(context, db, key, picker)
+		}
+	}
+
+	group.GET("/:token/preview/*wd", servePreview(pickCover))
+	group.GET("/:token/poster/*wd", servePreview(pickPoster))
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/model"
+)
+
+func TestShare(t *testing.T) {
+	tmp := t.TempDir()
+	root := path.Join(tmp, "root")
+	if err := os.MkdirAll(path.Join(root, "album"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(root, "album", "a.jpg"), []byte("album"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(root, "private.txt"), []byte(secret), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, db := setupTestDB(t)
+	if err := db.Create(&model.Datasource{Name: "local", Type: model.LOCAL, Cwd: root}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetupShareController(engine.Group("api/share"), db); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupPublicShareController(engine.Group("api/public/share"), db); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, target string, body any, header http.Header) *httptest.ResponseRecorder {
+		return request(engine, method, target, body, header)
+	}
+
+	code := func(recorder *httptest.ResponseRecorder) gocrud.Code {
+		var r gocrud.R[any]
+		_ = json.Unmarshal(recorder.Body.Bytes(), &r)
+		return r.Code
+	}
+
+	var created gocrud.R[ShareResult]
+	recorder := serve(http.MethodPost, "/api/share/create/1/album", ShareBody{
+		Scope:        model.ShareDownload,
+		Password:     "open sesame",
+		MaxDownloads: 2,
+	}, nil)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil || created.Data.Token == "" {
+		t.Fatalf("failed to create share: %s", recorder.Body.String())
+	}
+	prefix := "/api/public/share/" + created.Data.Token
+
+	if c := code(serve(http.MethodGet, prefix+"/file/a.jpg", nil, nil)); c != gocrud.RestCoder.FromStatus(http.StatusUnauthorized) {
+		t.Fatalf("expected password to be required, got %s", c)
+	}
+
+	recorder = serve(http.MethodPost, prefix+"/unlock", UnlockBody{Password: "open sesame"}, nil)
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected unlock cookie, got %s", recorder.Body.String())
+	}
+	unlocked := http.Header{"Cookie": {cookies[0].String()}}
+
+	if body := serve(http.MethodGet, prefix+"/file/a.jpg", nil, unlocked).Body.String(); body != "album" {
+		t.Fatalf("expected shared file, got %s", body)
+	}
+
+	for _, name := range []string{"/file/../private.txt", "/readdir/../"} {
+		if body := serve(http.MethodGet, prefix+name, nil, unlocked).Body.String(); strings.Contains(body, secret) {
+			t.Fatalf("%s escaped the share", name)
+		}
+	}
+
+	// parts of a stream are not downloads
+	ranged := http.Header{"Cookie": unlocked["Cookie"], "Range": {"bytes=1-2"}}
+	for i := 0; i < 3; i++ {
+		if body := serve(http.MethodGet, prefix+"/file/a.jpg", nil, ranged).Body.String(); body != "lb" {
+			t.Fatalf("expected part of shared file, got %s", body)
+		}
+	}
+
+	// the plain read above counted already, whatever the query says
+	if body := serve(http.MethodGet, prefix+"/file/a.jpg?download=1", nil, unlocked).Body.String(); body != "album" {
+		t.Fatalf("expected second download to pass, got %s", body)
+	}
+	for _, header := range []http.Header{
+		unlocked,
+		{"Cookie": unlocked["Cookie"], "Range": {"bytes=0-"}},
+		{"Cookie": unlocked["Cookie"], "Range": {"bytes=1-2"}, "If-Range": {`"stale"`}},
+	} {
+		if c := code(serve(http.MethodGet, prefix+"/file/a.jpg", nil, header)); c != gocrud.RestCoder.FromStatus(http.StatusGone) {
+			t.Fatalf("expected download limit for %v, got %s", header, c)
+		}
+	}
+
+	// preview scope streams, but does not download
+	recorder = serve(http.MethodPost, "/api/share/create/1/album", ShareBody{Scope: model.SharePreview}, nil)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil || created.Data.Token == "" {
+		t.Fatalf("failed to create share: %s", recorder.Body.String())
+	}
+	preview := "/api/public/share/" + created.Data.Token
+	for _, target := range []string{"/file/a.jpg", "/file/a.jpg?download=1", "/zip/"} {
+		if c := code(serve(http.MethodGet, preview+target, nil, nil)); c != gocrud.RestCoder.FromStatus(http.StatusForbidden) {
+			t.Fatalf("%s: expected download to be forbidden, got %s", target, c)
+		}
+	}
+	for _, header := range []http.Header{
+		{"Range": {"bytes=0-"}},
+		{"Range": {"bytes=0-4"}},
+		{"Range": {"bytes=1-2"}, "If-Range": {`"stale"`}},
+	} {
+		if c := code(serve(http.MethodGet, preview+"/file/a.jpg", nil, header)); c != gocrud.RestCoder.FromStatus(http.StatusForbidden) {
+			t.Fatalf("expected whole file to be forbidden for %v, got %s", header, c)
+		}
+	}
+	if body := serve(http.MethodGet, preview+"/file/a.jpg", nil, http.Header{"Range": {"bytes=1-2"}}).Body.String(); body != "lb" {
+		t.Fatalf("expected preview scope to stream, got %s", body)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	if err := db.Model(&model.Share{}).Where("1 = 1").Update("expires_at", &expired).Error; err != nil {
+		t.Fatal(err)
+	}
+	if c := code(serve(http.MethodGet, prefix+"/file/a.jpg", nil, unlocked)); c != gocrud.RestCoder.FromStatus(http.StatusGone) {
+		t.Fatalf("expected expired share, got %s", c)
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ApiTokenBody struct {
+	Name           string             `json:"name"`
+	Scopes         []model.TokenScope `json:"scopes"`
+	ExpiresInHours int64              `json:"expiresInHours"` // 0 for never
+}
+
+type ApiTokenResult struct {
+	Token    string         `json:"token"`
+	ApiToken model.ApiToken `json:"apiToken"`
+}
+
+// ownTokens limits a token query to the tokens of current user, admins see all of them
+func ownTokens(context *gin.Context, db *gorm.DB) *gorm.DB {
+	if user := CurrentUser(context); user != nil && !user.Admin {
+		return db.Where("`user_id` = ?", user.ID)
+	}
+	return db
+}
+
+// SetupApiTokenController lets users manage their own api tokens, the plain token is only returned on creation
+func SetupApiTokenController(group *gin.RouterGroup, db *gorm.DB) error {
+	err := gocrud.New(group, db, gocrud.Crud[model.ApiToken]{
+		EnableGetAll:  true,
+		DisableGetOne: true,
+		DisableSave:   true,
+		SearchHandlers: map[string]gocrud.SearchHandler{
+			"name":             gocrud.KeywordLike("name", nil),
+			"userId":           gocrud.KeywordEqual("user_id", nil),
+			"deleted":          gocrud.NewSoftDeleteSearchHandler(""),
+			"sortBy_createdAt": gocrud.SortBy("created_at"),
+		},
+		WillGetAll: ownTokens,
+		WillCount:  ownTokens,
+		WillPage: func(pageNum *int64, pageSize *int64, context *gin.Context, db *gorm.DB) *gorm.DB {
+			return ownTokens(context, db)
+		},
+		WillDelete: func(context *gin.Context, db *gorm.DB) {
+			// revoking tokens is up to the user, not to a token of lesser scope
+			if current := CurrentApiToken(context); current != nil && !current.Has(model.ScopeAdmin) {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "admin scope required")
+				return
+			}
+
+			var apiToken model.ApiToken
+			if err := ownTokens(context, db).First(&apiToken, context.Param("id")).Error; err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+			}
+		},
+		OnDelete: gocrud.NewSoftDeleteHandler[model.ApiToken](gocrud.RestCoder),
+	})
+	if err != nil {
+		return err
+	}
+
+	group.POST("/create", func(context *gin.Context) {
+		user := CurrentUser(context)
+		if user == nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), "auth is disabled")
+			return
+		}
+
+		var body ApiTokenBody
+		if err := context.ShouldBindJSON(&body); err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		} else if body.ExpiresInHours < 0 {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "invalid expiry")
+			return
+		}
+
+		// a token can not mint a token stronger than itself
+		if current := CurrentApiToken(context); current != nil {
+			for _, scope := range body.Scopes {
+				if !current.Has(scope) {
+					gocrud.MakeErrorResponse(context, gocrud.RestCoder.FromStatus(http.StatusForbidden), "scope exceeds current token")
+					return
+				}
+			}
+		}
+
+		token, apiToken, err := model.NewApiToken(*user, body.Name, body.Scopes, time.Duration(body.ExpiresInHours)*time.Hour)
+		if err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), err)
+			return
+		}
+
+		if err := db.Create(apiToken).Error; err != nil {
+			gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+			return
+		}
+
+		context.JSON(http.StatusOK, gocrud.R[ApiTokenResult]{
+			Code: gocrud.RestCoder.OK(),
+			Data: ApiTokenResult{Token: token, ApiToken: *apiToken},
+		})
+	})
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestApiToken(t *testing.T) {
+	engine, db := setupTestDB(t)
+
+	admin := model.User{Username: "admin", Admin: true}
+	if err := db.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tokenOf := func(scopes []model.TokenScope, ttl time.Duration) (string, *model.ApiToken) {
+		token, apiToken, err := model.NewApiToken(admin, "script", scopes, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(apiToken).Error; err != nil {
+			t.Fatal(err)
+		}
+		return token, apiToken
+	}
+
+	api := engine.Group("api", NewAuthMiddleware(db, false))
+	api.GET("/ping", func(context *gin.Context) {
+		context.String(http.StatusOK, "pong")
+	})
+	api.GET("/admin", RequireAdmin, func(context *gin.Context) {
+		context.String(http.StatusOK, "admin")
+	})
+	if err := SetupApiTokenController(api.Group("token"), db); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target, token string) string {
+		return request(engine, http.MethodGet, target, nil, http.Header{"Authorization": {"Bearer " + token}}).Body.String()
+	}
+
+	read, readToken := tokenOf([]model.TokenScope{model.ScopeRead}, 0)
+	if body := get("/api/ping", read); body != "pong" {
+		t.Fatalf("read token should be accepted, got %s", body)
+	}
+	if body := get("/api/admin", read); body == "admin" {
+		t.Fatalf("read token of an admin should not pass admin routes")
+	}
+
+	if err := db.First(readToken, readToken.ID).Error; err != nil {
+		t.Fatal(err)
+	} else if readToken.LastUsedAt == nil || readToken.LastUsedIP == "" {
+		t.Fatalf("last use should be recorded, got %+v", readToken)
+	}
+
+	full, _ := tokenOf([]model.TokenScope{model.ScopeAdmin}, time.Hour)
+	if body := get("/api/admin", full); body != "admin" {
+		t.Fatalf("admin token should pass admin routes, got %s", body)
+	}
+
+	victim, victimToken := tokenOf([]model.TokenScope{model.ScopeRead}, 0)
+	revoke := func(token string) gocrud.Code {
+		return responseCode(t, request(engine, http.MethodDelete, fmt.Sprintf("/api/token/%d", victimToken.ID), nil, http.Header{"Authorization": {"Bearer " + token}}), nil)
+	}
+	if code := revoke(read); code != gocrud.RestCoder.FromStatus(http.StatusForbidden) {
+		t.Fatalf("read token should not revoke tokens, got %s", code)
+	} else if body := get("/api/ping", victim); body != "pong" {
+		t.Fatalf("token should survive a refused revoke, got %s", body)
+	}
+	if code := revoke(full); code != gocrud.RestCoder.OK() {
+		t.Fatalf("admin token should revoke tokens, got %s", code)
+	} else if body := get("/api/ping", victim); body == "pong" {
+		t.Fatalf("revoked token should be rejected")
+	}
+
+	expired, _ := tokenOf([]model.TokenScope{model.ScopeRead}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if body := get("/api/ping", expired); body == "pong" {
+		t.Fatalf("expired token should be rejected")
+	}
+
+	if _, _, err := model.NewApiToken(admin, "bad", []model.TokenScope{"root"}, 0); err == nil {
+		t.Fatalf("unknown scope should be rejected")
+	}
+
+	acl := model.ACL{Admin: true, Scope: readToken.Actions()}
+	if !acl.Can(1, "/", model.ActionRead) || acl.Can(1, "/", model.ActionGenerate) || acl.IsAdmin() {
+		t.Fatalf("read scope should bound the acl of an admin")
+	}
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"github.com/allape/gocrud"
+	"github.com/allape/goview/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SetupUserController(group *gin.RouterGroup, db *gorm.DB) error {
+	return gocrud.New(group, db, gocrud.Crud[model.User]{
+		EnableGetAll: true,
+		SearchHandlers: map[string]gocrud.SearchHandler{
+			"username": gocrud.KeywordLike("username", nil),
+			"deleted":  gocrud.NewSoftDeleteSearchHandler(""),
+		},
+		WillSave: func(record *model.User, context *gin.Context, db *gorm.DB) {
+			if record.Password != "" {
+				hash, err := model.HashPassword(record.Password)
+				if err != nil {
+					gocrud.MakeErrorResponse(context, gocrud.RestCoder.InternalServerError(), err)
+					return
+				}
+				record.Password = hash
+				return
+			}
+
+			if record.ID == 0 {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.BadRequest(), "password is required")
+				return
+			}
+
+			// keep the current password
+			var existing model.User
+			if err := db.First(&existing, record.ID).Error; err != nil {
+				gocrud.MakeErrorResponse(context, gocrud.RestCoder.NotFound(), err)
+				return
+			}
+			record.Password = existing.Password
+		},
+		DidSave: func(record *model.User, context *gin.Context, db *gorm.DB) {
+			record.Password = ""
+			audit(context, db, model.AuditEvent{
+				Action: model.AuditUserSave,
+				Detail: record.Username,
+			})
+		},
+		DidGetAll: func(records []model.User, context *gin.Context, db *gorm.DB) {
+			for i := range records {
+				records[i].Password = ""
+			}
+		},
+		DidGetOne: func(record *model.User, context *gin.Context, db *gorm.DB) {
+			record.Password = ""
+		},
+		DidPage: func(pageNum int64, pageSize int64, list []model.User, context *gin.Context, db *gorm.DB) {
+			for i := range list {
+				list[i].Password = ""
+			}
+		},
+		OnDelete: gocrud.NewSoftDeleteHandler[model.User](gocrud.RestCoder),
+		DidDelete: func(context *gin.Context, db *gorm.DB) {
+			audit(context, db, model.AuditEvent{
+				Action: model.AuditUserDelete,
+				Detail: context.Param("id"),
+			})
+		},
+	})
+}
@@ -3,19 +3,57 @@ package env
 import "github.com/allape/goenv"
 
 const (
-	trustedCerts  = "GOVIEW_TRUSTED_CERTS"
-	uiFolder      = "GOVIEW_UI_FOLDER"
-	previewFolder = "GOVIEW_PREVIEW_FOLDER"
-	bindAddr      = "GOVIEW_BIND_ADDR"
-	enableCors    = "GOVIEW_ENABLE_CORS"
-	databaseDSN   = "GOVIEW_DATABASE_DSN"
+	trustedCerts   = "GOVIEW_TRUSTED_CERTS"
+	uiFolder       = "GOVIEW_UI_FOLDER"
+	previewFolder  = "GOVIEW_PREVIEW_FOLDER"
+	cacheFolder    = "GOVIEW_CACHE_FOLDER"
+	bindAddr       = "GOVIEW_BIND_ADDR"
+	enableCors     = "GOVIEW_ENABLE_CORS"
+	databaseDSN    = "GOVIEW_DATABASE_DSN"
+	sshKnownHosts  = "GOVIEW_SSH_KNOWN_HOSTS"
+	enableWrite    = "GOVIEW_ENABLE_WRITE"
+	localSymlinks  = "GOVIEW_LOCAL_SYMLINKS"
+	enableAuth     = "GOVIEW_ENABLE_AUTH"
+	adminUsername  = "GOVIEW_ADMIN_USERNAME"
+	adminPassword  = "GOVIEW_ADMIN_PASSWORD"
+	sessionTTL     = "GOVIEW_SESSION_TTL_HOURS"
+	credentialsKey = "GOVIEW_CREDENTIALS_KEY"
+	enableAudit    = "GOVIEW_ENABLE_AUDIT"
+	rateLimit      = "GOVIEW_RATE_LIMIT"
+	rateBurst      = "GOVIEW_RATE_BURST"
+	loginRateLimit = "GOVIEW_LOGIN_RATE_LIMIT"
+	loginRateBurst = "GOVIEW_LOGIN_RATE_BURST"
+	streamLimit    = "GOVIEW_STREAM_LIMIT"
+	healthInterval = "GOVIEW_HEALTH_INTERVAL_SECONDS"
+	healthTimeout  = "GOVIEW_HEALTH_TIMEOUT_SECONDS"
+	healthSlow     = "GOVIEW_HEALTH_SLOW_MS"
 )
 
 var (
-	TrustedCerts  = goenv.Getenv(trustedCerts, "")
-	UIFolder      = goenv.Getenv(uiFolder, "./ui/dist/")
-	PreviewFolder = goenv.Getenv(previewFolder, "./preview")
-	BindAddr      = goenv.Getenv(bindAddr, ":8080")
-	EnableCors    = goenv.Getenv(enableCors, true)
-	DatabaseDSN   = goenv.Getenv(databaseDSN, "root:Root_123456@tcp(localhost:3306)/goview?charset=utf8mb4&parseTime=True&loc=Local")
+	TrustedCerts    = goenv.Getenv(trustedCerts, "")
+	UIFolder        = goenv.Getenv(uiFolder, "./ui/dist/")
+	PreviewFolder   = goenv.Getenv(previewFolder, "./preview")
+	CacheFolder     = goenv.Getenv(cacheFolder, "./cache")
+	BindAddr        = goenv.Getenv(bindAddr, ":8080")
+	EnableCors      = goenv.Getenv(enableCors, true)
+	DatabaseDSN     = goenv.Getenv(databaseDSN, "root:Root_123456@tcp(localhost:3306)/goview?charset=utf8mb4&parseTime=True&loc=Local")
+	SSHKnownHosts   = goenv.Getenv(sshKnownHosts, "~/.ssh/known_hosts")
+	EnableWrite     = goenv.Getenv(enableWrite, false)
+	LocalSymlinks   = goenv.Getenv(localSymlinks, "inside")
+	EnableAuth      = goenv.Getenv(enableAuth, true)
+	AdminUsername   = goenv.Getenv(adminUsername, "admin")
+	AdminPassword   = goenv.Getenv(adminPassword, "")
+	SessionTTLHours = goenv.Getenv(sessionTTL, 24*30)
+	CredentialsKey  = goenv.Getenv(credentialsKey, "")
+	EnableAudit     = goenv.Getenv(enableAudit, true)
+	RateLimit       = goenv.Getenv(rateLimit, 50.0) // requests per second per user or ip, 0 to disable
+	RateBurst       = goenv.Getenv(rateBurst, 200)  // requests allowed at once before RateLimit kicks in
+	StreamLimit     = goenv.Getenv(streamLimit, 8)  // concurrent streams per user or ip per datasource, 0 to disable
+
+	LoginRateLimit = goenv.Getenv(loginRateLimit, 0.1) // login attempts per second per ip, 0 to disable
+	LoginRateBurst = goenv.Getenv(loginRateBurst, 5)   // login attempts allowed at once before LoginRateLimit kicks in
+
+	HealthIntervalSeconds = goenv.Getenv(healthInterval, 300) // between background health checks, 0 to disable
+	HealthTimeoutSeconds  = goenv.Getenv(healthTimeout, 10)
+	HealthSlowMS          = goenv.Getenv(healthSlow, 2000) // datasources slower than this are degraded
 )
@@ -1,32 +1,14 @@
 package env
 
-import (
-	"crypto/x509"
-	"os"
-	"strings"
-)
-
-func TrustedCertsPoolFromEnv() (*x509.CertPool, error) {
-	if TrustedCerts == "" {
-		return nil, nil
-	}
-
-	certs := strings.Split(TrustedCerts, ",")
-
-	caCertPool := x509.NewCertPool()
-
-	for _, cert := range certs {
-		cert = strings.TrimSpace(cert)
-		if cert == "" {
-			continue
-		}
-
-		caCert, err := os.ReadFile(cert)
-		if err != nil {
-			return nil, err
+import "strings"
+
+// TrustedCertFiles returns the PEM files in GOVIEW_TRUSTED_CERTS, the default CA bundle of datasources
+func TrustedCertFiles() []string {
+	var files []string
+	for _, file := range strings.Split(TrustedCerts, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
 		}
-		caCertPool.AppendCertsFromPEM(caCert)
 	}
-
-	return caCertPool, nil
+	return files
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"time"
 
 	"github.com/allape/gocrud"
@@ -35,11 +36,28 @@ func main() {
 		l.Error().Fatalln(err)
 	}
 
-	err = db.AutoMigrate(&model.Datasource{}, &model.Preview{})
+	err = db.AutoMigrate(
+		&model.Datasource{}, &model.Preview{},
+		&model.User{}, &model.Session{}, &model.ApiToken{},
+		&model.Group{}, &model.GroupMember{}, &model.Permission{},
+		&model.Share{}, &model.AuditEvent{},
+	)
 	if err != nil {
 		l.Error().Fatalf("Failed to auto migrate database: %v", err)
 	}
 
+	err = model.SealCwdCredentials(db)
+	if errors.Is(err, model.ErrNoCredentialsKey) {
+		l.Warn().Printf("Passwords in cwd of datasources are stored in plain text: %v", err)
+	} else if err != nil {
+		l.Error().Fatalf("Failed to seal credentials in cwd of datasources: %v", err)
+	}
+
+	err = controller.BootstrapAdmin(db)
+	if err != nil {
+		l.Error().Fatalf("Failed to create admin: %v", err)
+	}
+
 	engine := gin.Default()
 
 	if env.EnableCors {
@@ -49,14 +67,49 @@ func main() {
 		engine.Use(cors.New(config))
 	}
 
-	err = gocrud.NewSingleHTMLServe(engine.Group("/ui"), env.UIFolder, &gocrud.SingleHTMLServeConfig{
+	err = gocrud.NewSingleHTMLServe(engine.Group("/ui", controller.NewAuthMiddleware(db, true)), env.UIFolder, &gocrud.SingleHTMLServeConfig{
 		AllowReplace: true,
 	})
 	if err != nil {
 		l.Error().Fatalf("Failed to setup ui controller: %v", err)
 	}
 
-	apiGroup := engine.Group("api")
+	err = controller.SetupAuthController(engine.Group("api/auth"), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup auth controller: %v", err)
+	}
+
+	err = controller.SetupPublicShareController(engine.Group("api/public/share", controller.NewRateLimitMiddleware()), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup public share controller: %v", err)
+	}
+
+	apiGroup := engine.Group("api", controller.NewAuthMiddleware(db, false), controller.NewRateLimitMiddleware())
+
+	err = controller.SetupUserController(apiGroup.Group("user", controller.RequireAdmin), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup user controller: %v", err)
+	}
+
+	err = controller.SetupApiTokenController(apiGroup.Group("token"), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup api token controller: %v", err)
+	}
+
+	err = controller.SetupGroupController(apiGroup.Group("group", controller.RequireAdmin), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup group controller: %v", err)
+	}
+
+	err = controller.SetupGroupMemberController(apiGroup.Group("group-member", controller.RequireAdmin), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup group member controller: %v", err)
+	}
+
+	err = controller.SetupPermissionController(apiGroup.Group("permission", controller.RequireAdmin), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup permission controller: %v", err)
+	}
 
 	err = controller.SetupDatasourceController(apiGroup.Group("datasource"), db)
 	if err != nil {
@@ -68,6 +121,23 @@ func main() {
 		l.Error().Fatalf("Failed to setup preview controller: %v", err)
 	}
 
+	err = controller.SetupImageController(apiGroup.Group("image"), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup image controller: %v", err)
+	}
+
+	err = controller.SetupShareController(apiGroup.Group("share"), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup share controller: %v", err)
+	}
+
+	err = controller.SetupAuditController(apiGroup.Group("audit", controller.RequireAdmin), db)
+	if err != nil {
+		l.Error().Fatalf("Failed to setup audit controller: %v", err)
+	}
+
+	go controller.RunHealthChecks(db)
+
 	go func() {
 		err := engine.Run(env.BindAddr)
 		if err != nil {
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/allape/gocrud"
+)
+
+type Action uint8
+
+const (
+	ActionList     Action = 1 << iota // browse folders
+	ActionRead                        // download files and view previews
+	ActionGenerate                    // generate previews
+	ActionWrite                       // upload, mkdir, rename and delete
+	ActionAdmin                       // everything above, plus editing the datasource itself
+)
+
+type Group struct {
+	gocrud.Base
+	Name        string `json:"name"        gorm:"uniqueIndex;size:128"`
+	Description string `json:"description"`
+}
+
+type GroupMember struct {
+	gocrud.Base
+	GroupID gocrud.ID `json:"groupId" gorm:"index"`
+	UserID  gocrud.ID `json:"userId"  gorm:"index"`
+}
+
+// Permission grants Actions on Path and everything under it to a user or a group
+type Permission struct {
+	gocrud.Base
+	DatasourceID gocrud.ID `json:"datasourceId" gorm:"index"`
+	Path         string    `json:"path"`
+	UserID       gocrud.ID `json:"userId"       gorm:"index"`
+	GroupID      gocrud.ID `json:"groupId"      gorm:"index"`
+	Actions      Action    `json:"actions"`
+}
+
+// covers reports whether file is p.Path or under it
+func (p Permission) covers(file string) bool {
+	root := p.Path
+	if root == "" || root == "/" {
+		return true
+	}
+	root = strings.TrimSuffix(root, "/")
+	return file == root || strings.HasPrefix(file, root+"/")
+}
+
+// ACL is the permissions of a user, including the ones from groups
+type ACL struct {
+	Admin       bool
+	Permissions []Permission
+	Scope       Action // upper bound set by api token, 0 for no bound
+}
+
+// Allows reports whether action is within Scope
+func (a *ACL) Allows(action Action) bool {
+	return a.Scope == 0 || a.Scope&action == action
+}
+
+// IsAdmin reports whether a is an admin that is not bound by an api token
+func (a *ACL) IsAdmin() bool {
+	return a.Admin && a.Allows(ActionAdmin)
+}
+
+// Can reports whether action is granted on file, grants are additive
+func (a *ACL) Can(datasourceID gocrud.ID, file string, action Action) bool {
+	if !a.Allows(action) {
+		return false
+	} else if a.Admin {
+		return true
+	}
+
+	for _, permission := range a.Permissions {
+		if permission.DatasourceID != datasourceID || !permission.covers(file) {
+			continue
+		}
+		if permission.Actions&(action|ActionAdmin) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Leads reports whether folder file is an ancestor of a path where action is granted,
+// so that it can be walked through to reach the granted path
+func (a *ACL) Leads(datasourceID gocrud.ID, file string, action Action) bool {
+	if !a.Allows(action) {
+		return false
+	} else if a.Can(datasourceID, file, action) {
+		return true
+	}
+
+	file = strings.TrimSuffix(file, "/") + "/"
+	for _, permission := range a.Permissions {
+		if permission.DatasourceID != datasourceID || permission.Actions&(action|ActionAdmin) == 0 {
+			continue
+		}
+		if strings.HasPrefix(permission.Path, file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DatasourceIDs returns the datasources with any permission, nil for admin
+func (a *ACL) DatasourceIDs() []gocrud.ID {
+	if a.Admin {
+		return nil
+	}
+
+	ids := []gocrud.ID{}
+	seen := map[gocrud.ID]bool{}
+	for _, permission := range a.Permissions {
+		if permission.Actions != 0 && !seen[permission.DatasourceID] {
+			seen[permission.DatasourceID] = true
+			ids = append(ids, permission.DatasourceID)
+		}
+	}
+
+	return ids
+}
+
+// Readable returns the permissions granting read, used to scope preview queries
+func (a *ACL) Readable() []Permission {
+	if !a.Allows(ActionRead) {
+		return nil
+	}
+
+	var permissions []Permission
+	for _, permission := range a.Permissions {
+		if permission.Actions&(ActionRead|ActionAdmin) != 0 {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// KeyPrefix is the preview key of Path, previews under it start with it
+func (p Permission) KeyPrefix() FileKey {
+	return BuildPreviewKey(Datasource{Base: gocrud.Base{ID: p.DatasourceID}}, strings.TrimSuffix(p.Path, "/"))
+}
@@ -0,0 +1,600 @@
+package model
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const maxCachedArchives = 32
+
+type archiveKind int
+
+const (
+	archiveNone archiveKind = iota
+	archiveZip
+	archiveTar
+	archiveTarGz
+)
+
+func archiveKindOf(name string) archiveKind {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"), strings.HasSuffix(name, ".cbz"):
+		return archiveZip
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".cbt"):
+		return archiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGz
+	default:
+		return archiveNone
+	}
+}
+
+// IsArchive reports whether the file can be browsed like a folder
+func IsArchive(name string) bool {
+	return archiveKindOf(name) != archiveNone
+}
+
+type archiveEntry struct {
+	info   *fileInfo
+	zip    *zip.File
+	offset int64 // data offset of an entry in uncompressed tar
+}
+
+// archiveIndex is the parsed listing of an archive, file is kept open for random access
+type archiveIndex struct {
+	kind     archiveKind
+	file     File
+	readerAt io.ReaderAt
+	tmpFile  string
+	reopen   func() (File, error)
+
+	entries  map[string]*archiveEntry
+	children map[string][]*archiveEntry
+}
+
+func (a *archiveIndex) close() {
+	if a.file != nil {
+		_ = a.file.Close()
+	}
+	if a.tmpFile != "" {
+		_ = os.Remove(a.tmpFile)
+	}
+}
+
+func (a *archiveIndex) add(name string, entry *archiveEntry) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return
+	}
+
+	if existing, ok := a.entries[name]; ok {
+		// implicit folder is replaced by the real one
+		if existing.info.isDir && entry.info.isDir {
+			existing.info.mtime = entry.info.mtime
+		}
+		return
+	}
+
+	entry.info.name = path.Base(name)
+	a.entries[name] = entry
+
+	parent := path.Dir(name)
+	a.children[parent] = append(a.children[parent], entry)
+
+	if _, ok := a.entries[parent]; !ok && parent != "/" {
+		a.add(parent, &archiveEntry{info: &fileInfo{isDir: true}})
+	}
+}
+
+func (a *archiveIndex) stat(name string) (*archiveEntry, error) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return &archiveEntry{info: &fileInfo{name: "/", isDir: true}}, nil
+	}
+
+	entry, ok := a.entries[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	return entry, nil
+}
+
+func (a *archiveIndex) readDir(name string) ([]fs.DirEntry, error) {
+	entry, err := a.stat(name)
+	if err != nil {
+		return nil, err
+	} else if !entry.info.isDir {
+		return nil, fs.ErrInvalid
+	}
+
+	children := a.children[path.Clean("/"+name)]
+	entries := make([]fs.DirEntry, len(children))
+	for i, child := range children {
+		entries[i] = fs.FileInfoToDirEntry(child.info)
+	}
+
+	return entries, nil
+}
+
+// open returns the entry name, release is called once the returned file is closed
+func (a *archiveIndex) open(name string, release func()) (File, error) {
+	entry, err := a.stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.info.isDir {
+		return &archiveEntryFile{info: entry.info, release: release}, nil
+	}
+
+	switch a.kind {
+	case archiveZip:
+		if entry.zip.Method == zip.Store {
+			offset, err := entry.zip.DataOffset()
+			if err != nil {
+				return nil, err
+			}
+			reader := io.NewSectionReader(a.readerAt, offset, entry.info.size)
+			return &sectionFile{SectionReader: reader, info: entry.info, release: release}, nil
+		}
+		return &archiveEntryFile{info: entry.info, open: entry.zip.Open, release: release}, nil
+	case archiveTar:
+		reader := io.NewSectionReader(a.readerAt, entry.offset, entry.info.size)
+		return &sectionFile{SectionReader: reader, info: entry.info, release: release}, nil
+	default:
+		target := path.Clean("/" + name)
+		return &archiveEntryFile{info: entry.info, release: release, open: func() (io.ReadCloser, error) {
+			return a.scanTarGz(target)
+		}}, nil
+	}
+}
+
+// scanTarGz decompresses from the beginning until target is found
+func (a *archiveIndex) scanTarGz(target string) (io.ReadCloser, error) {
+	file, err := a.reopen()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := file.WriteTo(writer)
+		_ = writer.CloseWithError(err)
+	}()
+
+	entry := &tarGzEntry{file: file, pipe: reader}
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		_ = entry.Close()
+		return nil, err
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			_ = entry.Close()
+			return nil, fs.ErrNotExist
+		} else if err != nil {
+			_ = entry.Close()
+			return nil, err
+		}
+		if path.Clean("/"+header.Name) == target {
+			entry.Reader = tr
+			return entry, nil
+		}
+	}
+}
+
+type tarGzEntry struct {
+	io.Reader
+	file File
+	pipe *io.PipeReader
+}
+
+func (e *tarGzEntry) Close() error {
+	_ = e.pipe.CloseWithError(io.ErrClosedPipe)
+	return e.file.Close()
+}
+
+// countingReader tracks the offset of the underlying reader, archive/tar does not read ahead
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+func newArchiveIndex(dfs DatasourceFS, name string) (*archiveIndex, error) {
+	kind := archiveKindOf(name)
+	if kind == archiveNone {
+		return nil, fmt.Errorf("%s is not an archive", name)
+	}
+
+	file, err := dfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	index := &archiveIndex{
+		kind:     kind,
+		file:     file,
+		reopen:   func() (File, error) { return dfs.Open(name) },
+		entries:  map[string]*archiveEntry{},
+		children: map[string][]*archiveEntry{},
+	}
+
+	if kind != archiveTarGz {
+		if readerAt, ok := file.(io.ReaderAt); ok {
+			index.readerAt = readerAt
+		} else {
+			// random access is required, keep a local copy
+			tmpFile, err := os.CreateTemp(os.TempDir(), "goview_archive_*")
+			if err != nil {
+				index.close()
+				return nil, err
+			}
+			index.tmpFile = tmpFile.Name()
+			_, err = file.WriteTo(tmpFile)
+			_ = file.Close()
+			index.file = tmpFile
+			index.readerAt = tmpFile
+			if err != nil {
+				index.close()
+				return nil, err
+			}
+		}
+	}
+
+	switch kind {
+	case archiveZip:
+		err = index.indexZip(stat.Size())
+	case archiveTar:
+		err = index.indexTar(io.NewSectionReader(index.readerAt, 0, stat.Size()), true)
+	case archiveTarGz:
+		err = index.indexTarGz()
+	}
+	if err != nil {
+		index.close()
+		return nil, err
+	}
+
+	return index, nil
+}
+
+func (a *archiveIndex) indexZip(size int64) error {
+	reader, err := zip.NewReader(a.readerAt, size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range reader.File {
+		info := file.FileInfo()
+		a.add(file.Name, &archiveEntry{
+			info: &fileInfo{
+				size:  info.Size(),
+				mtime: info.ModTime(),
+				isDir: info.IsDir(),
+			},
+			zip: file,
+		})
+	}
+
+	return nil
+}
+
+func (a *archiveIndex) indexTar(reader io.Reader, withOffset bool) error {
+	counter := &countingReader{reader: reader}
+	tr := tar.NewReader(counter)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeDir:
+		default:
+			continue
+		}
+
+		entry := &archiveEntry{
+			info: &fileInfo{
+				size:  header.Size,
+				mtime: header.ModTime,
+				isDir: header.Typeflag == tar.TypeDir,
+			},
+		}
+		if withOffset {
+			entry.offset = counter.count
+		}
+
+		a.add(header.Name, entry)
+	}
+}
+
+func (a *archiveIndex) indexTarGz() error {
+	reader, writer := io.Pipe()
+
+	go func() {
+		_, err := a.file.WriteTo(writer)
+		_ = writer.CloseWithError(err)
+	}()
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		_ = reader.CloseWithError(err)
+		return err
+	}
+
+	err = a.indexTar(gz, false)
+	_ = reader.CloseWithError(io.EOF)
+
+	return err
+}
+
+type archiveEntryFile struct {
+	info    fs.FileInfo
+	open    func() (io.ReadCloser, error)
+	release func()
+}
+
+func (f *archiveEntryFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *archiveEntryFile) Close() error {
+	f.release()
+	return nil
+}
+
+func (f *archiveEntryFile) WriteTo(writer io.Writer) (int64, error) {
+	if f.open == nil {
+		return 0, fs.ErrInvalid
+	}
+
+	reader, err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	return io.Copy(writer, reader)
+}
+
+// sectionFile is an uncompressed entry which supports random access
+type sectionFile struct {
+	*io.SectionReader
+	info    fs.FileInfo
+	release func()
+}
+
+func (f *sectionFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *sectionFile) Close() error {
+	f.release()
+	return nil
+}
+
+func (f *sectionFile) WriteTo(writer io.Writer) (int64, error) {
+	return io.Copy(writer, io.NewSectionReader(f.SectionReader, 0, f.Size()))
+}
+
+// cachedArchive is indexed once by whoever asks first, the others wait for ready,
+// it is closed once evicted and released by every user
+type cachedArchive struct {
+	ready   chan struct{}
+	index   *archiveIndex
+	err     error
+	refs    int
+	evicted bool
+}
+
+var archiveCache = struct {
+	sync.Mutex
+	archives map[string]*cachedArchive
+	order    []string
+}{
+	archives: map[string]*cachedArchive{},
+}
+
+// evictArchive removes key from cache, archiveCache must be locked
+func evictArchive(key string) {
+	archive, ok := archiveCache.archives[key]
+	if !ok {
+		return
+	}
+
+	delete(archiveCache.archives, key)
+	for i, k := range archiveCache.order {
+		if k == key {
+			archiveCache.order = append(archiveCache.order[:i], archiveCache.order[i+1:]...)
+			break
+		}
+	}
+
+	archive.evicted = true
+	if archive.refs == 0 && archive.index != nil {
+		archive.index.close()
+	}
+}
+
+func (c *cachedArchive) release() {
+	archiveCache.Lock()
+	defer archiveCache.Unlock()
+
+	c.refs--
+	if c.refs == 0 && c.evicted && c.index != nil {
+		c.index.close()
+	}
+}
+
+// ArchiveFS layers on top of another DatasourceFS,
+// paths like /backup.zip/photos/1.jpg are resolved inside the archive
+type ArchiveFS struct {
+	DatasourceFS
+	id string
+}
+
+func NewArchiveFS(dfs DatasourceFS, id string) *ArchiveFS {
+	return &ArchiveFS{DatasourceFS: dfs, id: id}
+}
+
+// split finds the first archive in name, includeLast means the last segment can also be an archive
+func (f *ArchiveFS) split(name string, includeLast bool) (string, string, bool) {
+	segments := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+
+	if strings.HasSuffix(name, "/") {
+		includeLast = true
+	}
+
+	for i, segment := range segments {
+		if i == len(segments)-1 && !includeLast {
+			break
+		}
+		if !IsArchive(segment) {
+			continue
+		}
+
+		archive := "/" + strings.Join(segments[:i+1], "/")
+		stat, err := f.DatasourceFS.Stat(archive)
+		if err != nil || stat.IsDir() {
+			continue
+		}
+
+		return archive, "/" + strings.Join(segments[i+1:], "/"), true
+	}
+
+	return "", "", false
+}
+
+// index returns the cached index of archive, release must be called once done with it
+func (f *ArchiveFS) index(archive string) (*archiveIndex, func(), error) {
+	stat, err := f.DatasourceFS.Stat(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := fmt.Sprintf("%s:%s:%d:%d", f.id, archive, stat.Size(), stat.ModTime().UnixNano())
+
+	archiveCache.Lock()
+	cached, ok := archiveCache.archives[key]
+	if !ok {
+		cached = &cachedArchive{ready: make(chan struct{})}
+		archiveCache.archives[key] = cached
+		archiveCache.order = append(archiveCache.order, key)
+
+		if len(archiveCache.order) > maxCachedArchives {
+			evictArchive(archiveCache.order[0])
+		}
+	}
+	cached.refs++
+	archiveCache.Unlock()
+
+	if !ok {
+		// index without holding the cache, it may download the whole archive
+		cached.index, cached.err = newArchiveIndex(f.DatasourceFS, archive)
+		if cached.err != nil {
+			// leave it to the next request to retry
+			archiveCache.Lock()
+			if archiveCache.archives[key] == cached {
+				evictArchive(key)
+			}
+			archiveCache.Unlock()
+		}
+		close(cached.ready)
+	} else {
+		<-cached.ready
+	}
+
+	if cached.err != nil {
+		cached.release()
+		return nil, nil, cached.err
+	}
+
+	return cached.index, sync.OnceFunc(cached.release), nil
+}
+
+func (f *ArchiveFS) Open(name string) (File, error) {
+	archive, inner, ok := f.split(name, false)
+	if !ok {
+		return f.DatasourceFS.Open(name)
+	}
+
+	index, release, err := f.index(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := index.open(inner, release)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (f *ArchiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	archive, inner, ok := f.split(name, true)
+	if !ok {
+		return f.DatasourceFS.ReadDir(name)
+	}
+
+	index, release, err := f.index(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return index.readDir(inner)
+}
+
+func (f *ArchiveFS) Stat(name string) (fs.FileInfo, error) {
+	archive, inner, ok := f.split(name, false)
+	if !ok {
+		return f.DatasourceFS.Stat(name)
+	}
+
+	index, release, err := f.index(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	entry, err := index.stat(inner)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.info, nil
+}
@@ -0,0 +1,215 @@
+package model
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+var archiveTestFiles = map[string]string{
+	"readme.txt":       "hello",
+	"photos/1.jpg":     "not really a jpeg",
+	"photos/sub/2.jpg": "neither is this one",
+}
+
+func writeTestZip(t *testing.T, name string) {
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	writer := zip.NewWriter(file)
+	for entry, content := range archiveTestFiles {
+		method := zip.Deflate
+		if path.Ext(entry) == ".jpg" {
+			method = zip.Store
+		}
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: entry, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTar(t *testing.T, name string, compress bool) {
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var w io.Writer = file
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(file)
+		w = gz
+	}
+
+	writer := tar.NewWriter(w)
+	for entry, content := range archiveTestFiles {
+		err := writer.WriteHeader(&tar.Header{Name: entry, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchiveFS(t *testing.T) {
+	wd := t.TempDir()
+
+	writeTestZip(t, path.Join(wd, "a.zip"))
+	writeTestTar(t, path.Join(wd, "a.tar"), false)
+	writeTestTar(t, path.Join(wd, "a.tar.gz"), true)
+
+	dfs := NewArchiveFS(&LocalFS{wd: wd}, "test")
+
+	for _, archive := range []string{"/a.zip", "/a.tar", "/a.tar.gz"} {
+		stat, err := dfs.Stat(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.IsDir() {
+			t.Errorf("%s itself should be a file", archive)
+		}
+
+		entries, err := dfs.ReadDir(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		sort.Strings(names)
+		if len(names) != 2 || names[0] != "photos" || names[1] != "readme.txt" {
+			t.Errorf("unexpected entries of %s: %v", archive, names)
+		}
+
+		stat, err = dfs.Stat(archive + "/photos/sub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stat.IsDir() {
+			t.Errorf("implicit folder of %s should be a dir", archive)
+		}
+
+		for entry, content := range archiveTestFiles {
+			file, err := dfs.Open(archive + "/" + entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buf := &bytes.Buffer{}
+			_, err = file.WriteTo(buf)
+			_ = file.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != content {
+				t.Errorf("unexpected content of %s/%s: %s", archive, entry, buf.String())
+			}
+		}
+
+		if _, err := dfs.Open(archive + "/missing.txt"); err == nil {
+			t.Errorf("expected error for missing entry of %s", archive)
+		}
+	}
+}
+
+// countingFS counts the opens of each file
+type countingFS struct {
+	DatasourceFS
+	locker sync.Mutex
+	opens  map[string]int
+}
+
+func (f *countingFS) Open(name string) (File, error) {
+	f.locker.Lock()
+	f.opens[name]++
+	f.locker.Unlock()
+	// give concurrent requests the chance to pile up
+	time.Sleep(10 * time.Millisecond)
+	return f.DatasourceFS.Open(name)
+}
+
+func TestArchiveCache(t *testing.T) {
+	wd := t.TempDir()
+	writeTestTar(t, path.Join(wd, "a.tar"), false)
+
+	counting := &countingFS{DatasourceFS: &LocalFS{wd: wd}, opens: map[string]int{}}
+	dfs := NewArchiveFS(counting, "cache-test")
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			if _, err := dfs.ReadDir("/a.tar"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitGroup.Wait()
+	if opens := counting.opens["/a.tar"]; opens != 1 {
+		t.Fatalf("expected archive to be indexed once, opened %d times", opens)
+	}
+
+	file, err := dfs.Open("/a.tar/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// evict it while the file is open
+	for i := 0; i < maxCachedArchives; i++ {
+		name := fmt.Sprintf("/%d.tar", i)
+		writeTestTar(t, path.Join(wd, name), false)
+		if _, err := dfs.Stat(name + "/readme.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := file.WriteTo(buf); err != nil {
+		t.Fatalf("expected evicted archive to stay open for its files: %v", err)
+	} else if buf.String() != archiveTestFiles["readme.txt"] {
+		t.Fatalf("unexpected content %q", buf.String())
+	}
+	_ = file.Close()
+	_ = file.Close()
+
+	if _, err := file.(*sectionFile).ReadAt(make([]byte, 1), 0); err == nil {
+		t.Fatalf("expected evicted archive to be closed after its last file")
+	}
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"github.com/allape/gocrud"
+)
+
+type AuditAction string
+
+const (
+	AuditDatasourceSave   AuditAction = "datasource.save"
+	AuditDatasourceDelete AuditAction = "datasource.delete"
+	AuditPreviewGenerate  AuditAction = "preview.generate"
+	AuditPreviewDelete    AuditAction = "preview.delete"
+	AuditFileServe        AuditAction = "file.serve"
+	AuditFileZip          AuditAction = "file.zip"
+	AuditFileUpload       AuditAction = "file.upload"
+	AuditFileMkdir        AuditAction = "file.mkdir"
+	AuditFileRename       AuditAction = "file.rename"
+	AuditFileRemove       AuditAction = "file.remove"
+	AuditShareCreate      AuditAction = "share.create"
+	AuditShareUnlock      AuditAction = "share.unlock"
+	AuditShareReadDir     AuditAction = "share.readdir"
+	AuditUserSave         AuditAction = "user.save"
+	AuditUserDelete       AuditAction = "user.delete"
+	AuditPermissionSave   AuditAction = "permission.save"
+	AuditPermissionDelete AuditAction = "permission.delete"
+)
+
+// AuditEvent records who did what, CreatedAt is when it happened
+type AuditEvent struct {
+	gocrud.Base
+	Action       AuditAction `json:"action"       gorm:"index;size:32"`
+	UserID       gocrud.ID   `json:"userId"       gorm:"index"`
+	Username     string      `json:"username"     gorm:"size:128"`
+	ShareID      gocrud.ID   `json:"shareId"      gorm:"index"`
+	DatasourceID gocrud.ID   `json:"datasourceId" gorm:"index"`
+	Path         string      `json:"path"`
+	Bytes        int64       `json:"bytes"`
+	Range        string      `json:"range"        gorm:"size:128"`
+	Detail       string      `json:"detail"`
+	IP           string      `json:"ip"           gorm:"size:64"`
+	UserAgent    string      `json:"userAgent"`
+}
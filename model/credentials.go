@@ -0,0 +1,229 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	censored "github.com/allape/gocensored"
+	"github.com/allape/goview/env"
+	"gorm.io/gorm"
+)
+
+var ErrNoCredentialsKey = errors.New("credentials key is not set, see GOVIEW_CREDENTIALS_KEY")
+
+// Credentials of a datasource, they override the ones in Cwd.
+// They are sealed into Datasource.SealedCredentials and never sent back to client.
+type Credentials struct {
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"privateKey,omitempty"` // PEM, sftp only
+	Passphrase string `json:"passphrase,omitempty"` // of PrivateKey
+	Token      string `json:"token,omitempty"`      // bearer token for http based datasources
+}
+
+func (c Credentials) IsZero() bool {
+	return c == Credentials{}
+}
+
+// sealed is the carrier for gocensored, which works on tagged struct fields
+type sealed struct {
+	Value string `censored:"saltyaes.base64"`
+}
+
+var credentialsCensor = sync.OnceValues(func() (*censored.Censor, error) {
+	if env.CredentialsKey == "" {
+		return nil, ErrNoCredentialsKey
+	}
+	return censored.NewDefaultCensor(&censored.Config{
+		Password: []byte(env.CredentialsKey),
+	})
+})
+
+// SealCredentials encrypts credentials with env.CredentialsKey, zero credentials are sealed into ""
+func SealCredentials(credentials Credentials) (string, error) {
+	if credentials.IsZero() {
+		return "", nil
+	}
+
+	censor, err := credentialsCensor()
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := json.Marshal(credentials)
+	if err != nil {
+		return "", err
+	}
+
+	record := sealed{Value: string(plain)}
+	if err := censor.Encencor(&record); err != nil {
+		return "", err
+	}
+
+	return record.Value, nil
+}
+
+// OpenCredentials decrypts what SealCredentials returns
+func OpenCredentials(value string) (credentials Credentials, err error) {
+	if value == "" {
+		return credentials, nil
+	}
+
+	censor, err := credentialsCensor()
+	if err != nil {
+		return credentials, err
+	}
+
+	// the cipher panics on malformed input, e.g. sealed with another key
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to open credentials: %v", r)
+		}
+	}()
+
+	record := sealed{Value: value}
+	if err := censor.Decensor(&record); err != nil {
+		return credentials, err
+	}
+
+	if err := json.Unmarshal([]byte(record.Value), &credentials); err != nil {
+		return credentials, fmt.Errorf("failed to open credentials, wrong key? %w", err)
+	}
+
+	return credentials, nil
+}
+
+// SplitCwdCredentials takes the userinfo out of cwd, if cwd contains a password
+func SplitCwdCredentials(cwd string) (string, Credentials) {
+	u, err := url.Parse(cwd)
+	if err != nil || u.User == nil {
+		return cwd, Credentials{}
+	}
+
+	password, ok := u.User.Password()
+	if !ok {
+		return cwd, Credentials{}
+	}
+
+	credentials := Credentials{Username: u.User.Username(), Password: password}
+	u.User = nil
+
+	return u.String(), credentials
+}
+
+// SealCwdCredentials moves passwords saved in cwd before credentials were sealed into sealed credentials,
+// sealed ones win over the ones in cwd, as they do in GetFS
+func SealCwdCredentials(db *gorm.DB) error {
+	var datasources []Datasource
+	if err := db.Find(&datasources).Error; err != nil {
+		return err
+	}
+
+	for _, datasource := range datasources {
+		cwd, fromCwd := SplitCwdCredentials(datasource.Cwd)
+		if fromCwd.IsZero() {
+			continue
+		}
+
+		credentials, err := OpenCredentials(datasource.SealedCredentials)
+		if err != nil {
+			return fmt.Errorf("datasource %d: %w", datasource.ID, err)
+		}
+		if credentials.Username == "" {
+			credentials.Username = fromCwd.Username
+		}
+		if credentials.Password == "" {
+			credentials.Password = fromCwd.Password
+		}
+
+		sealed, err := SealCredentials(credentials)
+		if err != nil {
+			return fmt.Errorf("datasource %d: %w", datasource.ID, err)
+		}
+
+		err = db.Model(&Datasource{}).Where("`id` = ?", datasource.ID).UpdateColumns(map[string]any{
+			"cwd":                cwd,
+			"sealed_credentials": sealed,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		l.Info().Printf("Moved credentials in cwd of datasource %d into sealed credentials", datasource.ID)
+	}
+
+	return nil
+}
+
+// SameEndpoint reports whether cwd a and b point to the same server
+func SameEndpoint(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// withCredentials puts username and password into the userinfo of cwd
+func withCredentials(cwd string, credentials Credentials) (string, error) {
+	if credentials.Username == "" && credentials.Password == "" {
+		return cwd, nil
+	}
+
+	u, err := url.Parse(cwd)
+	if err != nil {
+		return "", err
+	}
+
+	username := credentials.Username
+	if username == "" && u.User != nil {
+		username = u.User.Username()
+	}
+
+	if credentials.Password != "" {
+		u.User = url.UserPassword(username, credentials.Password)
+	} else if password, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(username, password)
+	} else {
+		u.User = url.User(username)
+	}
+
+	return u.String(), nil
+}
+
+type bearerTransport struct {
+	token     string
+	transport http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.transport.RoundTrip(req)
+}
+
+// withBearer makes client send token in Authorization
+func withBearer(client *http.Client, token string) *http.Client {
+	if token == "" {
+		return client
+	}
+
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &http.Client{
+		Transport: &bearerTransport{token: token, transport: transport},
+		Timeout:   client.Timeout,
+	}
+}
@@ -1,32 +1,18 @@
 package model
 
 import (
-	"crypto/tls"
 	"errors"
 	"io"
 	"io/fs"
 	"net/http"
 	"os"
-	"path"
+	"strconv"
 
 	"github.com/allape/gocrud"
 	"github.com/allape/gohtvfs"
-	"github.com/allape/goview/env"
+	"gorm.io/gorm"
 )
 
-type LocalFS struct {
-	DatasourceFS
-	wd string
-}
-
-func (f *LocalFS) Open(name string) (File, error) {
-	return os.Open(path.Join(f.wd, name))
-}
-
-func (f *LocalFS) ReadDir(name string) ([]fs.DirEntry, error) {
-	return os.ReadDir(path.Join(f.wd, name))
-}
-
 type DuFS struct {
 	DatasourceFS
 	dufs *gohtvfs.DufsVFS
@@ -44,21 +30,34 @@ func (f *DuFS) ReadDir(name string) ([]fs.DirEntry, error) {
 	return f.dufs.ReadDir(name)
 }
 
+func (f *DuFS) Stat(name string) (fs.FileInfo, error) {
+	return f.dufs.Stat(name)
+}
+
 type File interface {
 	io.WriterTo
+	io.Closer
 	Stat() (os.FileInfo, error)
 }
 
 type DatasourceFS interface {
 	Open(name string) (File, error)
 	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
 }
 
 type Type string
 
 const (
-	DUFS  Type = "dufs"
-	LOCAL Type = "local"
+	DUFS       Type = "dufs"
+	LOCAL      Type = "local"
+	SFTP       Type = "sftp"
+	WEBDAV     Type = "webdav"
+	S3         Type = "s3"
+	FTP        Type = "ftp"
+	SMB        Type = "smb"
+	UNION      Type = "union"
+	HTTP_INDEX Type = "http-index"
 )
 
 type Datasource struct {
@@ -66,33 +65,102 @@ type Datasource struct {
 	Name string `json:"name"`
 	Type Type   `json:"type"`
 	Cwd  string `json:"cwd"`
+
+	// Credentials is write only, nil keeps the sealed ones when saving, empty clears them
+	Credentials       *Credentials `json:"credentials,omitempty" gorm:"-"`
+	SealedCredentials string       `json:"-"                     gorm:"type:text"`
+	HasCredentials    bool         `json:"hasCredentials"        gorm:"-"`
+
+	TLS TLSSettings `json:"tls" gorm:"embedded;embeddedPrefix:tls_"`
+
+	// Health is maintained by the server, see TestConnectivity
+	Health Health `json:"health" gorm:"embedded;embeddedPrefix:health_"`
+}
+
+func (d *Datasource) AfterFind(*gorm.DB) error {
+	d.HasCredentials = d.SealedCredentials != ""
+	return nil
 }
 
+func newHttpClient(settings TLSSettings) (*http.Client, error) {
+	transport, err := settings.Transport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// GetFS returns the filesystem of datasource, archives in it are browsable as folders
 func GetFS(datasource Datasource) (DatasourceFS, error) {
+	if datasource.Type == UNION {
+		// members are wrapped already
+		return NewUnionFS(datasource)
+	}
+
+	dfs, err := getFS(datasource)
+	if err != nil {
+		return nil, err
+	}
+	return NewArchiveFS(dfs, strconv.FormatUint(uint64(datasource.ID), 10)), nil
+}
+
+func getFS(datasource Datasource) (DatasourceFS, error) {
+	if datasource.Type == LOCAL {
+		return &LocalFS{wd: datasource.Cwd}, nil
+	}
+
+	credentials, err := OpenCredentials(datasource.SealedCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	cwd, err := withCredentials(datasource.Cwd, credentials)
+	if err != nil {
+		return nil, err
+	}
+
 	switch datasource.Type {
 	case DUFS:
-		caCertPool, err := env.TrustedCertsPoolFromEnv()
+		client, err := newHttpClient(datasource.TLS)
 		if err != nil {
 			return nil, err
 		}
-		tlsConfig := &tls.Config{
-			RootCAs: caCertPool,
-		}
-		client := &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: tlsConfig,
-			},
-		}
 
-		dufs, err := gohtvfs.NewDufsVFS(datasource.Cwd)
+		dufs, err := gohtvfs.NewDufsVFS(cwd)
 		if err != nil {
 			return nil, err
 		}
-		dufs.SetHttpClient(client)
+		dufs.SetHttpClient(withBearer(client, credentials.Token))
 
 		return &DuFS{dufs: dufs}, nil
-	case LOCAL:
-		return &LocalFS{wd: datasource.Cwd}, nil
+	case SFTP:
+		return NewSftpFS(cwd, []byte(credentials.PrivateKey), credentials.Passphrase)
+	case WEBDAV:
+		client, err := newHttpClient(datasource.TLS)
+		if err != nil {
+			return nil, err
+		}
+		return NewWebdavFS(cwd, withBearer(client, credentials.Token))
+	case S3:
+		client, err := newHttpClient(datasource.TLS)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3FS(cwd, client.Transport)
+	case FTP:
+		tlsConfig, err := datasource.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+		return NewFtpFS(cwd, tlsConfig)
+	case SMB:
+		return NewSmbFS(cwd)
+	case HTTP_INDEX:
+		client, err := newHttpClient(datasource.TLS)
+		if err != nil {
+			return nil, err
+		}
+		return NewHttpIndexFS(cwd, withBearer(client, credentials.Token))
 	default:
 		return nil, errors.New("datasource not supported")
 	}
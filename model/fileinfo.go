@@ -0,0 +1,41 @@
+package model
+
+import (
+	"io/fs"
+	"time"
+)
+
+// fileInfo is a plain fs.FileInfo for remote datasources
+type fileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+	isDir bool
+}
+
+func (f *fileInfo) Name() string {
+	return f.name
+}
+
+func (f *fileInfo) Size() int64 {
+	return f.size
+}
+
+func (f *fileInfo) Mode() fs.FileMode {
+	if f.isDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (f *fileInfo) ModTime() time.Time {
+	return f.mtime
+}
+
+func (f *fileInfo) IsDir() bool {
+	return f.isDir
+}
+
+func (f *fileInfo) Sys() any {
+	return nil
+}
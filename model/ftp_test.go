@@ -0,0 +1,344 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const ftpTestContent = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// ftpTestServer is a minimal ftp server serving /a.txt and /dir/b.txt over EPSV,
+// it advertises MLST if mlst is set, and rejects MLSD and MLST if broken is set
+type ftpTestServer struct {
+	listener net.Listener
+	mlst     bool
+	broken   bool
+
+	locker   sync.Mutex
+	conns    int
+	commands []string
+}
+
+func startFtpServer(t *testing.T, mlst, broken bool) *ftpTestServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &ftpTestServer{listener: listener, mlst: mlst, broken: broken}
+
+	var conns []net.Conn
+	t.Cleanup(func() {
+		_ = listener.Close()
+		server.locker.Lock()
+		defer server.locker.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.locker.Lock()
+			server.conns++
+			conns = append(conns, conn)
+			server.locker.Unlock()
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *ftpTestServer) cwd(query string) string {
+	return "ftp://goview:secret@" + s.listener.Addr().String() + "/" + query
+}
+
+func (s *ftpTestServer) sent(prefix string) []string {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	var commands []string
+	for _, command := range s.commands {
+		if strings.HasPrefix(command, prefix) {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+func (s *ftpTestServer) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	reply := func(lines ...string) {
+		_, _ = io.WriteString(conn, strings.Join(lines, "\r\n")+"\r\n")
+	}
+
+	var data net.Listener
+	var offset int
+	transfer := func(write func(conn net.Conn) error) {
+		if data == nil {
+			reply("425 use EPSV first")
+			return
+		}
+		dataConn, err := data.Accept()
+		_ = data.Close()
+		data = nil
+		if err != nil {
+			reply("425 can not open data connection")
+			return
+		}
+
+		reply("150 opening data connection")
+		err = write(dataConn)
+		_ = dataConn.Close()
+		if err != nil {
+			reply("426 transfer aborted")
+			return
+		}
+		reply("226 transfer complete")
+	}
+
+	reply("220 ready")
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		command, arg, _ := strings.Cut(scanner.Text(), " ")
+
+		s.locker.Lock()
+		s.commands = append(s.commands, scanner.Text())
+		s.locker.Unlock()
+
+		switch command {
+		case "USER":
+			reply("331 password please")
+		case "PASS":
+			reply("230 logged in")
+		case "FEAT":
+			if s.mlst {
+				reply("211-Features:", " MLST type*;size*;modify*;", " REST STREAM", "211 End")
+			} else {
+				reply("211-Features:", " REST STREAM", "211 End")
+			}
+		case "TYPE", "NOOP":
+			reply("200 ok")
+		case "EPSV":
+			var err error
+			data, err = net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				reply("425 can not listen")
+				continue
+			}
+			reply(fmt.Sprintf("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port))
+		case "REST":
+			offset, _ = strconv.Atoi(arg)
+			reply("350 restarting")
+		case "MLST":
+			size, isDir, ok := ftpTestEntry(arg)
+			if s.broken {
+				reply("500 not understood")
+			} else if !ok {
+				reply("550 not found")
+			} else {
+				reply("250-listing", " "+ftpTestFact(path.Base(arg), size, isDir), "250 end")
+			}
+		case "MLSD", "LIST":
+			if command == "MLSD" && s.broken {
+				reply("500 not understood")
+				continue
+			}
+			names, ok := map[string][]string{"/": {"a.txt", "dir"}, "/dir": {"b.txt"}}[arg]
+			if !ok {
+				reply("550 not found")
+				continue
+			}
+			transfer(func(conn net.Conn) error {
+				for _, name := range names {
+					size, isDir, _ := ftpTestEntry(path.Join(arg, name))
+					line := ftpTestFact(name, size, isDir)
+					if command == "LIST" {
+						mode := "-rw-r--r--"
+						if isDir {
+							mode = "drwxr-xr-x"
+						}
+						line = fmt.Sprintf("%s 1 goview goview %d Jan 02 15:04 %s", mode, size, name)
+					}
+					if _, err := io.WriteString(conn, line+"\r\n"); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		case "RETR":
+			size, isDir, ok := ftpTestEntry(arg)
+			if !ok || isDir || offset > size {
+				reply("550 not a file")
+				continue
+			}
+			from := offset
+			offset = 0
+			transfer(func(conn net.Conn) error {
+				_, err := io.WriteString(conn, ftpTestContent[from:])
+				return err
+			})
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func ftpTestEntry(name string) (int, bool, bool) {
+	switch name {
+	case "/a.txt", "/dir/b.txt":
+		return len(ftpTestContent), false, true
+	case "/dir":
+		return 0, true, true
+	}
+	return 0, false, false
+}
+
+func ftpTestFact(name string, size int, isDir bool) string {
+	kind := "file"
+	if isDir {
+		kind = "dir"
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=20240102150405; %s", kind, size, name)
+}
+
+func TestFtpFSListing(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		mlst   bool
+		broken bool
+		query  string
+	}{
+		{"mlsd", true, false, ""},
+		{"list", false, false, ""},
+		{"broken mlsd", true, true, "?mlsd=false"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			server := startFtpServer(t, c.mlst, c.broken)
+
+			dfs, err := NewFtpFS(server.cwd(c.query), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := dfs.ReadDir("/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, fmt.Sprintf("%s:%t", entry.Name(), entry.IsDir()))
+			}
+			if !slices.Equal(names, []string{"a.txt:false", "dir:true"}) {
+				t.Fatalf("unexpected entries %v", names)
+			}
+
+			info, err := dfs.Stat("/dir/b.txt")
+			if err != nil {
+				t.Fatal(err)
+			} else if info.Name() != "b.txt" || info.Size() != int64(len(ftpTestContent)) || info.IsDir() {
+				t.Fatalf("unexpected stat %s %d %t", info.Name(), info.Size(), info.IsDir())
+			}
+
+			if _, err := dfs.Stat("/missing.txt"); err == nil {
+				t.Fatalf("expected missing file to fail")
+			}
+
+			used, unused := "LIST", "MLSD"
+			if c.mlst && !c.broken {
+				used, unused = unused, used
+			}
+			if len(server.sent(used)) == 0 || len(server.sent(unused)) != 0 {
+				t.Fatalf("expected %s only, got %v", used, server.sent(""))
+			}
+		})
+	}
+}
+
+func TestFtpFSRead(t *testing.T) {
+	server := startFtpServer(t, true, false)
+
+	dfs, err := NewFtpFS(server.cwd(""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := dfs.Open("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	readAt := func(size int, off int64) string {
+		p := make([]byte, size)
+		n, err := file.(io.ReaderAt).ReadAt(p, off)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		return string(p[:n])
+	}
+
+	if s := readAt(4, 10); s != "abcd" {
+		t.Fatalf("unexpected read at 10: %q", s)
+	}
+	if s := readAt(4, 14); s != "efgh" {
+		t.Fatalf("unexpected read at 14: %q", s)
+	}
+	if retrs := server.sent("RETR"); len(retrs) != 1 {
+		t.Fatalf("expected sequential reads to share one transfer, got %v", retrs)
+	}
+
+	if s := readAt(3, 2); s != "234" {
+		t.Fatalf("unexpected read at 2: %q", s)
+	}
+	if s := readAt(100, 30); s != "uvwxyz" {
+		t.Fatalf("unexpected read at 30: %q", s)
+	}
+
+	if _, err := file.(io.Seeker).Seek(33, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(file.(io.Reader))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(rest) != "xyz" {
+		t.Fatalf("unexpected read after seek: %q", rest)
+	}
+
+	if rests := server.sent("REST"); !slices.Equal(rests, []string{"REST 10", "REST 2", "REST 30", "REST 33"}) {
+		t.Fatalf("unexpected offsets %v", rests)
+	}
+
+	server.locker.Lock()
+	conns := server.conns
+	server.locker.Unlock()
+	if conns != 1 {
+		t.Fatalf("expected aborted transfers to keep the connection, dialed %d times", conns)
+	}
+
+	if _, err := dfs.Open("/missing.txt"); err == nil {
+		t.Fatalf("expected missing file to fail")
+	}
+}
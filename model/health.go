@@ -0,0 +1,123 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type HealthStatus string
+
+const (
+	HealthOK       HealthStatus = "ok"
+	HealthDegraded HealthStatus = "degraded" // reachable, but slow or some union members are down
+	HealthDown     HealthStatus = "down"
+)
+
+var ErrConnectivityTimeout = errors.New("connection test timed out")
+
+// Health of a datasource as of its last check
+type Health struct {
+	Status    HealthStatus `json:"status"    gorm:"size:16"`
+	Latency   int64        `json:"latency"` // milliseconds to open the fs and list its root
+	Error     string       `json:"error"     gorm:"type:text"`
+	CheckedAt *time.Time   `json:"checkedAt"`
+}
+
+// ConnectivityResult of opening a datasource and listing its root
+type ConnectivityResult struct {
+	Status  HealthStatus `json:"status"`
+	Latency int64        `json:"latency"`
+	Entries int          `json:"entries"`
+	Error   string       `json:"error,omitempty"`
+}
+
+func (r ConnectivityResult) Health(checkedAt time.Time) Health {
+	return Health{
+		Status:    r.Status,
+		Latency:   r.Latency,
+		Error:     r.Error,
+		CheckedAt: &checkedAt,
+	}
+}
+
+func listRoot(datasource Datasource) (int, error) {
+	dfs, err := GetFS(datasource)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := dfs.ReadDir("/")
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// TestConnectivity opens datasource and lists its root within timeout,
+// it is degraded when slower than slow, a timed out test keeps running in background until the fs gives up
+func TestConnectivity(datasource Datasource, timeout, slow time.Duration) ConnectivityResult {
+	type listed struct {
+		entries int
+		err     error
+	}
+
+	start := time.Now()
+	done := make(chan listed, 1)
+	go func() {
+		entries, err := listRoot(datasource)
+		done <- listed{entries, err}
+	}()
+
+	var result listed
+	select {
+	case result = <-done:
+	case <-time.After(timeout):
+		result.err = ErrConnectivityTimeout
+	}
+
+	latency := time.Since(start)
+
+	if result.err != nil {
+		return ConnectivityResult{Status: HealthDown, Latency: latency.Milliseconds(), Error: result.err.Error()}
+	}
+
+	status := HealthOK
+	message := ""
+	if latency > slow {
+		status = HealthDegraded
+		message = fmt.Sprintf("slower than %s", slow)
+	}
+
+	// a union lists fine as long as one member does
+	if datasource.Type == UNION {
+		if err := unionMembersDown(datasource, timeout, slow); err != nil {
+			status = HealthDegraded
+			message = err.Error()
+		}
+	}
+
+	return ConnectivityResult{Status: status, Latency: latency.Milliseconds(), Entries: result.entries, Error: message}
+}
+
+func unionMembersDown(datasource Datasource, timeout, slow time.Duration) error {
+	config, err := ParseUnionConfig(datasource.Cwd)
+	if err != nil {
+		return err
+	}
+	if DatasourceLoader == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, id := range config.Sources {
+		member, err := DatasourceLoader(id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("member %d: %w", id, err))
+			continue
+		}
+		if result := TestConnectivity(member, timeout, slow); result.Status == HealthDown {
+			errs = append(errs, fmt.Errorf("member %d: %s", id, result.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,188 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/allape/goview/util"
+)
+
+// authTransports keeps one AuthTransport per user of a server,
+// so that the digest challenge outlives the filesystem built for a request
+var authTransports = struct {
+	sync.Mutex
+	transports map[string]*util.AuthTransport
+}{
+	transports: map[string]*util.AuthTransport{},
+}
+
+func authTransportOf(root *url.URL, transport http.RoundTripper) *util.AuthTransport {
+	username := root.User.Username()
+	password, _ := root.User.Password()
+	key := root.Scheme + "://" + username + "@" + root.Host
+
+	authTransports.Lock()
+	defer authTransports.Unlock()
+
+	// replaced once the password or tls settings change
+	cached, ok := authTransports.transports[key]
+	if ok && cached.Password == password && cached.Transport == transport {
+		return cached
+	}
+
+	cached = &util.AuthTransport{
+		Username:  username,
+		Password:  password,
+		Transport: transport,
+	}
+	authTransports.transports[key] = cached
+
+	return cached
+}
+
+// withUserinfo moves the credentials in root into an authenticating client
+func withUserinfo(client *http.Client, root *url.URL) *http.Client {
+	if root.User == nil {
+		return client
+	}
+
+	client = &http.Client{
+		Transport: authTransportOf(root, client.Transport),
+		Timeout:   client.Timeout,
+	}
+	root.User = nil
+
+	return client
+}
+
+// httpFile reads a remote file with plain GET, and ranged GET for random access
+type httpFile struct {
+	client *http.Client
+	href   string
+	info   fs.FileInfo
+
+	locker sync.Mutex
+	offset int64
+}
+
+func newHttpFile(client *http.Client, href string, info fs.FileInfo) *httpFile {
+	return &httpFile{
+		client: client,
+		href:   href,
+		info:   info,
+	}
+}
+
+func (f *httpFile) get(header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, f.href, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, fs.ErrNotExist
+	} else if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		_ = resp.Body.Close()
+		return nil, errors.New(resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (f *httpFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *httpFile) Close() error {
+	return nil
+}
+
+func (f *httpFile) WriteTo(writer io.Writer) (int64, error) {
+	resp, err := f.get(nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	return io.Copy(writer, resp.Body)
+}
+
+func (f *httpFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.info.Size() {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+
+	resp, err := f.get(header)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// range not supported
+	if resp.StatusCode != http.StatusPartialContent && off > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := io.ReadFull(resp.Body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *httpFile) Read(p []byte) (int, error) {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *httpFile) Seek(offset int64, whence int) (int64, error) {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, fs.ErrInvalid
+	}
+
+	if offset < 0 {
+		return 0, fs.ErrInvalid
+	}
+
+	f.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const apacheIndex = `<html><body><h1>Index of /pub/docs</h1><table>
+<tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th></tr>
+<tr><td><a href="/pub/">Parent Directory</a></td></tr>
+<tr><td><a href="guide%201.pdf">guide 1.pdf</a></td><td>2024-01-02 03:04</td></tr>
+<tr><td><a href="images/">images/</a></td><td>2024-01-02 03:04</td></tr>
+</table></body></html>`
+
+const nginxJsonIndex = `[
+{ "name":"images", "type":"directory", "mtime":"Tue, 02 Jan 2024 03:04:05 GMT" },
+{ "name":"guide 1.pdf", "type":"file", "mtime":"Tue, 02 Jan 2024 03:04:05 GMT", "size":42 }
+]`
+
+func namesOf(t *testing.T, dfs DatasourceFS, name string) []string {
+	entries, err := dfs.ReadDir(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		suffix := ""
+		if entry.IsDir() {
+			suffix = "/"
+		}
+		names = append(names, entry.Name()+suffix)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestHttpIndexFS(t *testing.T) {
+	wd := t.TempDir()
+	if err := os.MkdirAll(path.Join(wd, "images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(wd, "images", "1.jpg"), []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/files/", http.StripPrefix("/files", http.FileServer(http.Dir(wd))))
+	mux.HandleFunc("/pub/docs/", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/html")
+		_, _ = writer.Write([]byte(apacheIndex))
+	})
+	mux.HandleFunc("/json/", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(nginxJsonIndex))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dfs, err := NewHttpIndexFS(server.URL+"/files/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := namesOf(t, dfs, "/"); strings.Join(names, ",") != "images/" {
+		t.Errorf("unexpected entries %v", names)
+	}
+
+	entries, err := dfs.ReadDir("/images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	info, err := entries[0].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 4 || info.ModTime().IsZero() {
+		t.Errorf("unexpected info from HEAD %d %s", info.Size(), info.ModTime())
+	}
+
+	stat, err := dfs.Stat("/images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.IsDir() {
+		t.Errorf("expected /images to be a folder")
+	}
+
+	file, err := dfs.Open("/images/1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := file.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "jpeg" {
+		t.Errorf("unexpected content %s", buf.String())
+	}
+
+	apache, err := NewHttpIndexFS(server.URL+"/pub/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := namesOf(t, apache, "/docs"); strings.Join(names, ",") != "guide 1.pdf,images/" {
+		t.Errorf("unexpected apache entries %v", names)
+	}
+
+	nginx, err := NewHttpIndexFS(server.URL+"/json/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := namesOf(t, nginx, "/"); strings.Join(names, ",") != "guide 1.pdf,images/" {
+		t.Errorf("unexpected json entries %v", names)
+	}
+}
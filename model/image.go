@@ -0,0 +1,242 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/allape/goview/util"
+)
+
+type ImageFormat string
+
+const (
+	JPEG ImageFormat = "jpeg"
+	WEBP ImageFormat = "webp"
+	PNG  ImageFormat = "png"
+)
+
+const (
+	MaxResizeSize         = 4096
+	DefaultResizeQuality  = 80
+	DefaultResizeFormat   = JPEG
+	DefaultResizeFit      = util.FitContain
+	resizedImageSubFolder = "resized"
+)
+
+var (
+	ErrInvalidResizeSize    = errors.New("width and height must be between 0 and 4096")
+	ErrInvalidResizeFit     = errors.New("fit must be one of contain, cover or fill")
+	ErrInvalidResizeFormat  = errors.New("format must be one of jpeg, webp or png")
+	ErrInvalidResizeQuality = errors.New("quality must be between 1 and 100")
+)
+
+type ResizeOptions struct {
+	Width   int
+	Height  int
+	Fit     util.ImageFit
+	Format  ImageFormat
+	Quality int
+}
+
+func (o *ResizeOptions) Normalize() error {
+	if o.Width < 0 || o.Width > MaxResizeSize || o.Height < 0 || o.Height > MaxResizeSize {
+		return ErrInvalidResizeSize
+	}
+
+	switch o.Fit {
+	case "":
+		o.Fit = DefaultResizeFit
+	case util.FitContain, util.FitCover, util.FitFill:
+	default:
+		return ErrInvalidResizeFit
+	}
+
+	switch o.Format {
+	case "":
+		o.Format = DefaultResizeFormat
+	case "jpg":
+		o.Format = JPEG
+	case JPEG, WEBP, PNG:
+	default:
+		return ErrInvalidResizeFormat
+	}
+
+	if o.Quality == 0 {
+		o.Quality = DefaultResizeQuality
+	} else if o.Quality < 1 || o.Quality > 100 {
+		return ErrInvalidResizeQuality
+	}
+
+	return nil
+}
+
+func (o *ResizeOptions) Ext() string {
+	switch o.Format {
+	case WEBP:
+		return ".webp"
+	case PNG:
+		return ".png"
+	default:
+		return ".jpg"
+	}
+}
+
+func (o *ResizeOptions) MIME() string {
+	switch o.Format {
+	case WEBP:
+		return "image/webp"
+	case PNG:
+		return "image/png"
+	default:
+		return "image/jpeg"
+	}
+}
+
+// CacheFile returns the path of the resized image relative to the cache folder
+func (o *ResizeOptions) CacheFile(digest string) string {
+	return path.Join(
+		resizedImageSubFolder,
+		digest[0:4],
+		fmt.Sprintf("%s_%dx%d_%s_q%d%s", digest, o.Width, o.Height, o.Fit, o.Quality, o.Ext()),
+	)
+}
+
+// resizeConcurrency is the number of ffmpeg processes resizing at once
+const resizeConcurrency = 4
+
+var resizeSlots = make(chan struct{}, resizeConcurrency)
+
+// resizing holds the destinations being produced, requests for the same one wait for it instead
+var resizing = struct {
+	sync.Mutex
+	files map[string]chan struct{}
+}{
+	files: map[string]chan struct{}{},
+}
+
+func cachedFile(file string) bool {
+	stat, err := os.Stat(file)
+	return err == nil && !stat.IsDir() && stat.Size() > 0
+}
+
+// produceOnce calls produce unless dst is cached, or being produced by another request,
+// in which case it waits and checks again
+func produceOnce(dst string, produce func() error) error {
+	for {
+		if cachedFile(dst) {
+			return nil
+		}
+
+		resizing.Lock()
+		done, busy := resizing.files[dst]
+		if !busy {
+			done = make(chan struct{})
+			resizing.files[dst] = done
+		}
+		resizing.Unlock()
+
+		if busy {
+			<-done
+			continue
+		}
+
+		err := produce()
+
+		resizing.Lock()
+		delete(resizing.files, dst)
+		resizing.Unlock()
+		close(done)
+
+		return err
+	}
+}
+
+func resize(src, dst string, options ResizeOptions) error {
+	err := os.MkdirAll(path.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpDst := fmt.Sprintf("%s.tmp%s", dst, options.Ext())
+	defer func() {
+		_ = os.Remove(tmpDst)
+	}()
+
+	resizeSlots <- struct{}{}
+	_, err = util.FFMpegResizeImage(tmpDst, src, options.Width, options.Height, options.Fit, options.Quality)
+	<-resizeSlots
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpDst, dst)
+}
+
+// ResizeImage resizes a local image file, digest is used as the cache key
+func ResizeImage(src, digest, cacheFolder string, options ResizeOptions) (string, error) {
+	if err := options.Normalize(); err != nil {
+		return "", err
+	}
+
+	dst := path.Join(cacheFolder, options.CacheFile(digest))
+
+	return dst, produceOnce(dst, func() error {
+		l.Info().Printf("resizing %s to %s", src, dst)
+		return resize(src, dst, options)
+	})
+}
+
+// FileVersionDigest identifies the content of name in datasource by its size and mtime, without reading it
+func FileVersionDigest(datasource Datasource, name string, stat fs.FileInfo) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%d:%d", datasource.ID, name, stat.Size(), stat.ModTime().UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// CoverVersionDigest identifies the cover of preview by its size and mtime, a regenerated or replaced cover gets a new one
+func CoverVersionDigest(preview Preview, stat fs.FileInfo) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%d:%d", preview.Digest, preview.Cover, stat.Size(), stat.ModTime().UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResizeImageFromDatasource resizes an image from datasource,
+// it is only downloaded if the resized image of its current version is not cached
+func ResizeImageFromDatasource(datasource Datasource, srcFile, cacheFolder string, options ResizeOptions) (string, error) {
+	if err := options.Normalize(); err != nil {
+		return "", err
+	}
+
+	dfs, err := GetFS(datasource)
+	if err != nil {
+		return "", err
+	}
+
+	stat, err := dfs.Stat(srcFile)
+	if err != nil {
+		return "", err
+	} else if stat.IsDir() {
+		return "", errors.New("can not resize a directory")
+	}
+
+	dst := path.Join(cacheFolder, options.CacheFile(FileVersionDigest(datasource, srcFile, stat)))
+
+	return dst, produceOnce(dst, func() error {
+		tmpFile, err := CopyToTempFile(datasource, srcFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tmpFile.Close()
+			_ = os.Remove(tmpFile.Name())
+		}()
+
+		l.Info().Printf("resizing %s to %s", srcFile, dst)
+
+		return resize(tmpFile.Name(), dst, options)
+	})
+}
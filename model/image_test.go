@@ -0,0 +1,36 @@
+package model
+
+import (
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProduceOnce(t *testing.T) {
+	dst := path.Join(t.TempDir(), "resized.jpg")
+
+	var produced atomic.Int32
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			err := produceOnce(dst, func() error {
+				produced.Add(1)
+				time.Sleep(20 * time.Millisecond)
+				return os.WriteFile(dst, []byte("resized"), 0644)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	if n := produced.Load(); n != 1 {
+		t.Fatalf("expected concurrent requests to share one resize, resized %d times", n)
+	}
+}
@@ -0,0 +1,399 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/allape/goview/env"
+)
+
+var ErrInvalidPath = errors.New("invalid path")
+var ErrSymlinkNotAllowed = errors.New("symbolic link is not allowed")
+
+type SymlinkPolicy string
+
+const (
+	SymlinkInside SymlinkPolicy = "inside" // follow relative links which stay inside Cwd
+	SymlinkNever  SymlinkPolicy = "never"  // refuse any path crossing a link
+	SymlinkAlways SymlinkPolicy = "always" // follow links anywhere, .. is still rejected
+)
+
+// CleanPath normalizes a path taken from url into an absolute path inside datasource,
+// paths with .. or NUL are rejected instead of being silently clamped
+func CleanPath(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", ErrInvalidPath
+	}
+
+	for _, segment := range strings.Split(strings.ReplaceAll(name, "\\", "/"), "/") {
+		if segment == ".." {
+			return "", ErrInvalidPath
+		}
+	}
+
+	return path.Clean("/" + name), nil
+}
+
+// localRoot is the subset of os.Root used by LocalFS
+type localRoot interface {
+	Open(name string) (*os.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Create(name string) (*os.File, error)
+	Mkdir(name string, perm fs.FileMode) error
+	Rename(oldname, newname string) error
+	RemoveAll(name string) error
+}
+
+// dirRoot joins paths without confinement, for SymlinkAlways
+type dirRoot string
+
+func (r dirRoot) join(name string) string {
+	return path.Join(string(r), name)
+}
+
+func (r dirRoot) Open(name string) (*os.File, error) {
+	return os.Open(r.join(name))
+}
+
+func (r dirRoot) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(r.join(name))
+}
+
+func (r dirRoot) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(r.join(name))
+}
+
+func (r dirRoot) Create(name string) (*os.File, error) {
+	return os.Create(r.join(name))
+}
+
+func (r dirRoot) Mkdir(name string, perm fs.FileMode) error {
+	return os.Mkdir(r.join(name), perm)
+}
+
+func (r dirRoot) Rename(oldname, newname string) error {
+	return os.Rename(r.join(oldname), r.join(newname))
+}
+
+func (r dirRoot) RemoveAll(name string) error {
+	return os.RemoveAll(r.join(name))
+}
+
+// linklessRoot refuses to resolve any symbolic link, for SymlinkNever
+type linklessRoot struct {
+	*os.Root
+}
+
+func symlinkNotAllowed(name string) error {
+	return fmt.Errorf("%w: %s", ErrSymlinkNotAllowed, name)
+}
+
+// openLinklessDir opens folder name in root, and makes sure the opened one is what Lstat saw,
+// so that name replaced by a link in between is noticed
+func openLinklessDir(root *os.Root, name string) (*os.Root, error) {
+	stat, err := root.Lstat(name)
+	if err != nil {
+		return nil, err
+	} else if stat.Mode()&fs.ModeSymlink != 0 {
+		return nil, symlinkNotAllowed(name)
+	}
+
+	dir, err := root.OpenRoot(name)
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := dir.Stat(".")
+	if err != nil || !os.SameFile(stat, opened) {
+		_ = dir.Close()
+		return nil, symlinkNotAllowed(name)
+	}
+
+	return dir, nil
+}
+
+// parent opens the folder holding name one segment at a time, and returns it with the last segment of name,
+// the returned root must be closed
+func (r linklessRoot) parent(name string) (*os.Root, string, error) {
+	dir, base := path.Split(path.Clean(name))
+	if base == "" {
+		base = "."
+	}
+
+	current, err := r.Root.OpenRoot(".")
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, segment := range strings.Split(dir, "/") {
+		if segment == "" || segment == "." {
+			continue
+		}
+		next, err := openLinklessDir(current, segment)
+		_ = current.Close()
+		if err != nil {
+			return nil, "", err
+		}
+		current = next
+	}
+
+	return current, base, nil
+}
+
+// lstat is Lstat of name, which must not be a link
+func (r linklessRoot) lstat(name string) (fs.FileInfo, error) {
+	parent, base, err := r.parent(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = parent.Close()
+	}()
+
+	stat, err := parent.Lstat(base)
+	if err != nil {
+		return nil, err
+	} else if stat.Mode()&fs.ModeSymlink != 0 {
+		return nil, symlinkNotAllowed(name)
+	}
+
+	return stat, nil
+}
+
+// open opens name with flag, and makes sure the opened file is not reached through a link
+func (r linklessRoot) open(name string, flag int) (*os.File, error) {
+	parent, base, err := r.parent(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = parent.Close()
+	}()
+
+	stat, err := parent.Lstat(base)
+	if err == nil && stat.Mode()&fs.ModeSymlink != 0 {
+		return nil, symlinkNotAllowed(name)
+	} else if err != nil && (flag&os.O_CREATE == 0 || !errors.Is(err, fs.ErrNotExist)) {
+		return nil, err
+	}
+
+	file, err := parent.OpenFile(base, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the handle, base may have been replaced after Lstat
+	opened, err := file.Stat()
+	if err == nil {
+		stat, err = parent.Lstat(base)
+	}
+	if err != nil || !os.SameFile(stat, opened) {
+		_ = file.Close()
+		return nil, symlinkNotAllowed(name)
+	}
+
+	return file, nil
+}
+
+func (r linklessRoot) Open(name string) (*os.File, error) {
+	return r.open(name, os.O_RDONLY)
+}
+
+func (r linklessRoot) Stat(name string) (fs.FileInfo, error) {
+	return r.lstat(name)
+}
+
+func (r linklessRoot) Create(name string) (*os.File, error) {
+	return r.open(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+func (r linklessRoot) Mkdir(name string, perm fs.FileMode) error {
+	parent, base, err := r.parent(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = parent.Close()
+	}()
+	return parent.Mkdir(base, perm)
+}
+
+func (r linklessRoot) Rename(oldname, newname string) error {
+	for _, name := range []string{oldname, newname} {
+		parent, _, err := r.parent(name)
+		if err != nil {
+			return err
+		}
+		_ = parent.Close()
+	}
+	return r.Root.Rename(oldname, newname)
+}
+
+func (r linklessRoot) RemoveAll(name string) error {
+	parent, base, err := r.parent(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		_ = parent.Close()
+	}()
+	return parent.RemoveAll(base)
+}
+
+// localRoots keeps one opened os.Root for each Cwd, until Cwd is found replaced
+var localRoots = struct {
+	sync.Mutex
+	roots map[string]*os.Root
+}{
+	roots: map[string]*os.Root{},
+}
+
+func openLocalRoot(wd string) (*os.Root, error) {
+	localRoots.Lock()
+	defer localRoots.Unlock()
+
+	if root, ok := localRoots.roots[wd]; ok {
+		return root, nil
+	}
+
+	root, err := os.OpenRoot(wd)
+	if err != nil {
+		return nil, err
+	}
+
+	localRoots.roots[wd] = root
+
+	return root, nil
+}
+
+// forgetStaleLocalRoot closes the cached root of wd if wd is no longer the folder it was opened on,
+// e.g. the disk was remounted or the folder was re-created, returns whether it was stale
+func forgetStaleLocalRoot(wd string) bool {
+	localRoots.Lock()
+	defer localRoots.Unlock()
+
+	root, ok := localRoots.roots[wd]
+	if !ok {
+		return false
+	}
+
+	opened, err := root.Stat(".")
+	if err == nil {
+		var current fs.FileInfo
+		current, err = os.Stat(wd)
+		if err == nil && os.SameFile(opened, current) {
+			return false
+		}
+	}
+
+	delete(localRoots.roots, wd)
+	_ = root.Close()
+
+	return true
+}
+
+// retryOnStaleRoot calls op once more if it failed on a stale root of f
+func retryOnStaleRoot[T any](f *LocalFS, op func() (T, error)) (T, error) {
+	result, err := op()
+	if err != nil && forgetStaleLocalRoot(f.wd) {
+		return op()
+	}
+	return result, err
+}
+
+type LocalFS struct {
+	DatasourceFS
+	wd string
+}
+
+// root returns the confined root of f according to env.LocalSymlinks, and name relative to it
+func (f *LocalFS) root(name string) (localRoot, string, error) {
+	name, err := CleanPath(name)
+	if err != nil {
+		return nil, "", err
+	}
+	name = "." + name
+
+	policy := SymlinkPolicy(env.LocalSymlinks)
+	if policy == SymlinkAlways {
+		return dirRoot(f.wd), name, nil
+	}
+
+	root, err := openLocalRoot(f.wd)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if policy == SymlinkNever {
+		return linklessRoot{root}, name, nil
+	}
+
+	return root, name, nil
+}
+
+func (f *LocalFS) Open(name string) (File, error) {
+	return retryOnStaleRoot(f, func() (File, error) {
+		root, name, err := f.root(name)
+		if err != nil {
+			return nil, err
+		}
+		return root.Open(name)
+	})
+}
+
+func (f *LocalFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return retryOnStaleRoot(f, func() ([]fs.DirEntry, error) {
+		return f.readDir(name)
+	})
+}
+
+func (f *LocalFS) readDir(name string) ([]fs.DirEntry, error) {
+	root, name, err := f.root(name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = dir.Close()
+	}()
+
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := root.(linklessRoot); ok {
+		entries = slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+			return entry.Type()&fs.ModeSymlink != 0
+		})
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+func (f *LocalFS) Stat(name string) (fs.FileInfo, error) {
+	return retryOnStaleRoot(f, func() (fs.FileInfo, error) {
+		root, name, err := f.root(name)
+		if err != nil {
+			return nil, err
+		}
+		return root.Stat(name)
+	})
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/allape/goview/env"
+)
+
+func TestLocalFSSymlinkPolicy(t *testing.T) {
+	wd := t.TempDir()
+
+	if err := os.WriteFile(path.Join(wd, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", path.Join(wd, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := env.LocalSymlinks
+	defer func() {
+		env.LocalSymlinks = policy
+	}()
+
+	dfs := &LocalFS{wd: wd}
+
+	env.LocalSymlinks = string(SymlinkInside)
+	if _, err := dfs.Stat("/b.txt"); err != nil {
+		t.Errorf("expected link inside root to be followed, got %v", err)
+	}
+	if _, err := dfs.Stat("/../a.txt"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("expected invalid path, got %v", err)
+	}
+
+	env.LocalSymlinks = string(SymlinkNever)
+	if _, err := dfs.Stat("/b.txt"); !errors.Is(err, ErrSymlinkNotAllowed) {
+		t.Errorf("expected link to be refused, got %v", err)
+	}
+	entries, err := dfs.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected links to be hidden, got %d entries", len(entries))
+	}
+}
+
+func TestLocalFSNeverFollowsNestedLinks(t *testing.T) {
+	wd := t.TempDir()
+
+	if err := os.MkdirAll(path.Join(wd, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(wd, "sub", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub", path.Join(wd, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := env.LocalSymlinks
+	defer func() {
+		env.LocalSymlinks = policy
+	}()
+	env.LocalSymlinks = string(SymlinkNever)
+
+	dfs := &LocalFS{wd: wd}
+
+	file, err := dfs.Open("/sub/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	for _, name := range []string{"/link/a.txt", "/link"} {
+		if _, err := dfs.Open(name); !errors.Is(err, ErrSymlinkNotAllowed) {
+			t.Errorf("expected %s to be refused, got %v", name, err)
+		}
+	}
+	if _, err := dfs.WriteFile("/link/b.txt", strings.NewReader("b")); !errors.Is(err, ErrSymlinkNotAllowed) {
+		t.Errorf("expected writing through a link to be refused, got %v", err)
+	}
+	if err := dfs.Mkdir("/link/dir"); !errors.Is(err, ErrSymlinkNotAllowed) {
+		t.Errorf("expected mkdir through a link to be refused, got %v", err)
+	}
+
+	if _, err := dfs.WriteFile("/sub/b.txt", strings.NewReader("b")); err != nil {
+		t.Fatal(err)
+	} else if content, _ := os.ReadFile(path.Join(wd, "sub", "b.txt")); string(content) != "b" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestLocalFSReopensReplacedRoot(t *testing.T) {
+	tmp := t.TempDir()
+	wd := path.Join(tmp, "mnt")
+	if err := os.MkdirAll(wd, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dfs := &LocalFS{wd: wd}
+	if _, err := dfs.ReadDir("/"); err != nil {
+		t.Fatal(err)
+	}
+
+	// as if another disk was mounted there
+	if err := os.Rename(wd, path.Join(tmp, "old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(wd, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(wd, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dfs.Stat("/new.txt"); err != nil {
+		t.Fatalf("expected the replaced root to be re-opened, got %v", err)
+	}
+}
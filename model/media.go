@@ -0,0 +1,65 @@
+package model
+
+import (
+	"strconv"
+
+	"github.com/allape/goview/util"
+)
+
+type Chapter struct {
+	Start float64 `json:"start"` // in seconds
+	End   float64 `json:"end"`   // in seconds
+	Title string  `json:"title"`
+}
+
+type AudioTrack struct {
+	Index         int    `json:"index"`
+	Codec         string `json:"codec"`
+	Language      string `json:"language"`
+	Title         string `json:"title"`
+	Channels      int    `json:"channels"`
+	ChannelLayout string `json:"channelLayout"`
+	SampleRate    int    `json:"sampleRate"`
+	Default       bool   `json:"default"`
+}
+
+func ChaptersOf(ffprobe *util.FFProbeJson) []Chapter {
+	var chapters []Chapter
+	for _, chapter := range ffprobe.Chapters {
+		start, err := strconv.ParseFloat(chapter.StartTime, 64)
+		if err != nil {
+			continue
+		}
+		end, err := strconv.ParseFloat(chapter.EndTime, 64)
+		if err != nil {
+			continue
+		}
+		chapters = append(chapters, Chapter{
+			Start: start,
+			End:   end,
+			Title: chapter.Title(),
+		})
+	}
+	return chapters
+}
+
+func AudioTracksOf(ffprobe *util.FFProbeJson) []AudioTrack {
+	var tracks []AudioTrack
+	for _, stream := range ffprobe.Streams {
+		if stream.CodecType != util.Audio {
+			continue
+		}
+		sampleRate, _ := strconv.Atoi(stream.SampleRate)
+		tracks = append(tracks, AudioTrack{
+			Index:         stream.Index,
+			Codec:         stream.CodecName,
+			Language:      stream.Language(),
+			Title:         stream.Title(),
+			Channels:      stream.Channels,
+			ChannelLayout: stream.ChannelLayout,
+			SampleRate:    sampleRate,
+			Default:       stream.IsDefault(),
+		})
+	}
+	return tracks
+}
@@ -6,6 +6,7 @@ import (
 	"image"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,26 +23,49 @@ type FileKey string
 
 type Preview struct {
 	gocrud.Base
-	DatasourceID gocrud.ID `json:"datasourceId"`
-	Key          FileKey   `json:"key"`
-	Digest       string    `json:"digest" gorm:"type:varchar(64)"`
-	Cover        string    `json:"cover"`
-	MIME         string    `json:"mime"`
-	FFProbeInfo  string    `json:"ffprobeInfo"`
+	DatasourceID gocrud.ID    `json:"datasourceId"`
+	Key          FileKey      `json:"key"`
+	Digest       string       `json:"digest" gorm:"type:varchar(64)"`
+	Cover        string       `json:"cover"`
+	MIME         string       `json:"mime"`
+	FFProbeInfo  string       `json:"ffprobeInfo"`
+	Poster       string       `json:"poster"`
+	PosterAt     float64      `json:"posterAt"` // in seconds
+	Subtitles    []Subtitle   `json:"subtitles" gorm:"serializer:json;type:text"`
+	Chapters     []Chapter    `json:"chapters" gorm:"serializer:json;type:text"`
+	AudioTracks  []AudioTrack `json:"audioTracks" gorm:"serializer:json;type:text"`
 }
 
+const FileKeyScheme = "goview://"
+
 func BuildPreviewKey(datasource Datasource, file string) FileKey {
-	return FileKey(fmt.Sprintf("goview://%d%s", datasource.ID, file))
+	return FileKey(fmt.Sprintf("%s%d%s", FileKeyScheme, datasource.ID, file))
 }
 
-var locker = &sync.Mutex{}
+// Split returns the datasource id and the file path of the key
+func (k FileKey) Split() (gocrud.ID, string) {
+	rest := strings.TrimPrefix(string(k), FileKeyScheme)
 
-func GeneratePreview(datasource Datasource, srcFile, dstFolder string, finder func(digest string) (*Preview, error)) (*Preview, error) {
-	key := BuildPreviewKey(datasource, srcFile)
+	id, file, found := strings.Cut(rest, "/")
+	if !found {
+		file = ""
+	}
 
-	locker.Lock()
-	defer locker.Unlock()
+	datasourceId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, ""
+	}
+
+	return gocrud.ID(datasourceId), "/" + file
+}
+
+const PosterCandidates = 12
 
+var locker = &sync.Mutex{}
+
+// CopyToTempFile downloads srcFile from datasource into a temp file,
+// the caller is responsible for closing and removing it
+func CopyToTempFile(datasource Datasource, srcFile string) (*os.File, error) {
 	dfs, err := GetFS(datasource)
 	if err != nil {
 		return nil, err
@@ -51,6 +75,9 @@ func GeneratePreview(datasource Datasource, srcFile, dstFolder string, finder fu
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		_ = file.Close()
+	}()
 
 	stat, err := file.Stat()
 	if err != nil {
@@ -63,18 +90,36 @@ func GeneratePreview(datasource Datasource, srcFile, dstFolder string, finder fu
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = tmpFile.Close()
-		_ = os.Remove(tmpFile.Name())
-	}()
 
 	n, err := file.WriteTo(tmpFile)
 	if err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
 		return nil, err
 	} else if n != stat.Size() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
 		return nil, fmt.Errorf("unable to read the whole file, expected %d, got %d", stat.Size(), n)
 	}
 
+	return tmpFile, nil
+}
+
+func GeneratePreview(datasource Datasource, srcFile, dstFolder string, finder func(digest string) (*Preview, error)) (*Preview, error) {
+	key := BuildPreviewKey(datasource, srcFile)
+
+	locker.Lock()
+	defer locker.Unlock()
+
+	tmpFile, err := CopyToTempFile(datasource, srcFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+
 	digest, err := util.Sha256(tmpFile)
 	if err != nil {
 		return nil, err
@@ -91,6 +136,7 @@ func GeneratePreview(datasource Datasource, srcFile, dstFolder string, finder fu
 		found.DeletedAt = nil
 		found.DatasourceID = datasource.ID
 		found.Key = key
+		found.Subtitles = withSidecarSubtitles(datasource, srcFile, found.Subtitles)
 		return found, nil
 	}
 
@@ -114,6 +160,16 @@ func GeneratePreview(datasource Datasource, srcFile, dstFolder string, finder fu
 		return nil, err
 	}
 
+	if fileType.MIME.Type == "video" {
+		ffprobe, err := util.FFProbe(tmpFile.Name())
+		if err != nil {
+			return nil, err
+		}
+		prev.Subtitles = withSidecarSubtitles(datasource, srcFile, EmbeddedSubtitles(ffprobe))
+		prev.Chapters = ChaptersOf(ffprobe)
+		prev.AudioTracks = AudioTracksOf(ffprobe)
+	}
+
 	fullDstFilePath := path.Join(dstFolder, dstFile)
 
 	err = os.MkdirAll(path.Dir(fullDstFilePath), 0755)
@@ -150,7 +206,7 @@ func GeneratePreview(datasource Datasource, srcFile, dstFolder string, finder fu
 				}
 			}
 		case "video":
-			_, err = util.FFMpegVideoSampleImage(tmpFile.Name(), fullDstFilePath, 0.25, image.Point{X: 10, Y: 10})
+			_, err = util.FFMpegVideoContactSheet(tmpFile.Name(), fullDstFilePath, path.Base(srcFile), 0.25, image.Point{X: 10, Y: 10})
 			if err != nil {
 				return nil, err
 			}
@@ -161,5 +217,18 @@ func GeneratePreview(datasource Datasource, srcFile, dstFolder string, finder fu
 		prev.Cover = dstFile
 	}
 
+	// even if the cover exists, it may have been generated before posters were,
+	// and the chosen timestamp is not kept anywhere else
+	if fileType.MIME.Type == "video" {
+		posterFile := fmt.Sprintf("%s/%s.poster.%s", digest[0:4], digest, "jpg")
+		at, err := util.FFMpegVideoPoster(tmpFile.Name(), path.Join(dstFolder, posterFile), PosterCandidates, 0.5)
+		if err != nil {
+			l.Warn().Printf("failed to generate poster for %s: %v", key, err)
+		} else {
+			prev.Poster = posterFile
+			prev.PosterAt = at.Seconds()
+		}
+	}
+
 	return &prev, nil
 }
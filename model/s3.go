@@ -0,0 +1,218 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config is parsed from Cwd of a datasource,
+// e.g. s3://access_key:secret_key@minio.lan:9000/bucket/prefix?region=us-east-1&path_style=true&secure=false
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	Secure    bool
+}
+
+func ParseS3Config(cwd string) (*S3Config, error) {
+	u, err := url.Parse(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "s3" {
+		return nil, fmt.Errorf("s3: unsupported scheme %s", u.Scheme)
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("s3: bucket is required")
+	}
+
+	query := u.Query()
+
+	config := &S3Config{
+		Endpoint:  u.Host,
+		Region:    query.Get("region"),
+		Bucket:    bucket,
+		Prefix:    strings.Trim(prefix, "/"),
+		AccessKey: u.User.Username(),
+		PathStyle: query.Get("path_style") == "true",
+		Secure:    query.Get("secure") != "false",
+	}
+	config.SecretKey, _ = u.User.Password()
+
+	return config, nil
+}
+
+type S3FS struct {
+	DatasourceFS
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3FS(cwd string, transport http.RoundTripper) (*S3FS, error) {
+	config, err := ParseS3Config(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if config.PathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure:       config.Secure,
+		Region:       config.Region,
+		BucketLookup: bucketLookup,
+		Transport:    transport,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3FS{client: client, bucket: config.Bucket, prefix: config.Prefix}, nil
+}
+
+func (f *S3FS) key(name string) string {
+	return strings.Trim(path.Join(f.prefix, name), "/")
+}
+
+func (f *S3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	prefix := f.key(name)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var entries []fs.DirEntry
+	for object := range f.client.ListObjects(context.Background(), f.bucket, minio.ListObjectsOptions{
+		Prefix: prefix,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		entryName := strings.TrimSuffix(strings.TrimPrefix(object.Key, prefix), "/")
+		if entryName == "" {
+			// placeholder object of the folder itself
+			continue
+		}
+
+		entries = append(entries, fs.FileInfoToDirEntry(&fileInfo{
+			name:  entryName,
+			size:  object.Size,
+			mtime: object.LastModified,
+			isDir: strings.HasSuffix(object.Key, "/"),
+		}))
+	}
+
+	return entries, nil
+}
+
+func (f *S3FS) Stat(name string) (fs.FileInfo, error) {
+	key := f.key(name)
+	if key == "" {
+		return &fileInfo{name: "/", isDir: true}, nil
+	}
+
+	object, err := f.client.StatObject(context.Background(), f.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return &fileInfo{
+			name:  path.Base(key),
+			size:  object.Size,
+			mtime: object.LastModified,
+		}, nil
+	} else if minio.ToErrorResponse(err).Code != minio.NoSuchKey {
+		return nil, err
+	}
+
+	// there are no real folders in s3, a prefix with any object under it is treated as a folder
+	for object := range f.client.ListObjects(context.Background(), f.bucket, minio.ListObjectsOptions{
+		Prefix:  key + "/",
+		MaxKeys: 1,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		return &fileInfo{name: path.Base(key), isDir: true}, nil
+	}
+
+	return nil, fs.ErrNotExist
+}
+
+func (f *S3FS) Open(name string) (File, error) {
+	info, err := f.Stat(name)
+	if err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return &s3File{info: info}, nil
+	}
+
+	object, err := f.client.GetObject(context.Background(), f.bucket, f.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3File{object: object, info: info}, nil
+}
+
+// s3File reads object with ranged GETs, object is nil for folders
+type s3File struct {
+	object *minio.Object
+	info   fs.FileInfo
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *s3File) Close() error {
+	if f.object == nil {
+		return nil
+	}
+	return f.object.Close()
+}
+
+func (f *s3File) WriteTo(writer io.Writer) (int64, error) {
+	if f.object == nil {
+		return 0, fs.ErrInvalid
+	}
+	return io.Copy(writer, f.object)
+}
+
+func (f *s3File) Read(p []byte) (int, error) {
+	if f.object == nil {
+		return 0, fs.ErrInvalid
+	}
+	return f.object.Read(p)
+}
+
+func (f *s3File) ReadAt(p []byte, off int64) (int, error) {
+	if f.object == nil {
+		return 0, fs.ErrInvalid
+	}
+	return f.object.ReadAt(p, off)
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	if f.object == nil {
+		return 0, fs.ErrInvalid
+	}
+	return f.object.Seek(offset, whence)
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestS3FS(t *testing.T) {
+	server := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	defer server.Close()
+
+	endpoint, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4("goview", "secret", ""),
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := client.MakeBucket(ctx, "archive", minio.MakeBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range map[string]string{
+		"photos/2024/a.jpg":   "0123456789",
+		"photos/2024/b.jpg":   "b",
+		"photos/2023/c/d.jpg": "d",
+		"photos/readme.txt":   "readme",
+		"videos/e.mp4":        "e",
+	} {
+		if _, err := client.PutObject(ctx, "archive", key, strings.NewReader(content), int64(len(content)), minio.PutObjectOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dfs, err := NewS3FS("s3://goview:secret@"+endpoint.Host+"/archive/photos?path_style=true&secure=false", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := dfs.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, entry := range entries {
+		found[entry.Name()] = entry.IsDir()
+	}
+	if len(found) != 3 || !found["2024"] || !found["2023"] || found["readme.txt"] {
+		t.Fatalf("unexpected entries %v", found)
+	}
+
+	stat, err := dfs.Stat("/2023/c")
+	if err != nil {
+		t.Fatal(err)
+	} else if !stat.IsDir() {
+		t.Errorf("expected /2023/c to be a folder")
+	}
+
+	if _, err := dfs.Stat("/2022"); err == nil {
+		t.Errorf("expected /2022 to be missing")
+	}
+
+	file, err := dfs.Open("/2024/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	stat, err = file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	} else if stat.Size() != 10 {
+		t.Errorf("unexpected size %d", stat.Size())
+	}
+
+	buf := make([]byte, 4)
+	if _, err := file.(io.ReaderAt).ReadAt(buf, 6); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != "6789" {
+		t.Errorf("unexpected ranged content %q", buf)
+	}
+
+	content := &bytes.Buffer{}
+	if _, err := file.WriteTo(content); err != nil {
+		t.Fatal(err)
+	} else if content.String() != "0123456789" {
+		t.Errorf("unexpected content %q", content.String())
+	}
+}
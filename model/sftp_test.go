@@ -0,0 +1,248 @@
+package model
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	sftpTestUser     = "goview"
+	sftpTestPassword = "Goview_123456"
+)
+
+// startSftpServer serves wd over sftp on a random local port, returns the address and the host key,
+// users log in with sftpTestPassword or any of keys
+func startSftpServer(t *testing.T, wd string, keys ...ssh.PublicKey) (string, ssh.PublicKey) {
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == sftpTestUser && string(password) == sftpTestPassword {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, authorized := range keys {
+				if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("key rejected for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSftpConn(conn, config, wd)
+		}
+	}()
+
+	return listener.Addr().String(), hostSigner.PublicKey()
+}
+
+func serveSftpConn(conn net.Conn, config *ssh.ServerConfig, wd string) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(wd))
+				if err != nil {
+					return
+				}
+				_ = server.Serve()
+				_ = channel.Close()
+			}
+		}()
+	}
+}
+
+func writeKnownHosts(t *testing.T, addr string, key ssh.PublicKey) string {
+	file := path.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)
+	if err := os.WriteFile(file, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSftpFS(t *testing.T) {
+	wd := t.TempDir()
+	if err := os.MkdirAll(path.Join(wd, "photos"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(wd, "photos", "1.jpg"), []byte("not really a jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, hostKey := startSftpServer(t, wd)
+	knownHosts := writeKnownHosts(t, addr, hostKey)
+
+	dfs, err := GetFS(Datasource{
+		Type: SFTP,
+		Cwd:  fmt.Sprintf("sftp://%s:%s@%s%s?known_hosts=%s", sftpTestUser, sftpTestPassword, addr, wd, knownHosts),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := dfs.ReadDir("/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "1.jpg" || entries[0].IsDir() {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	stat, err := dfs.Stat("/photos")
+	if err != nil {
+		t.Fatal(err)
+	} else if !stat.IsDir() {
+		t.Errorf("expected /photos to be a directory")
+	}
+
+	file, err := dfs.Open("/photos/1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	content := &strings.Builder{}
+	if _, err := file.WriteTo(content); err != nil {
+		t.Fatal(err)
+	} else if content.String() != "not really a jpeg" {
+		t.Errorf("unexpected content %q", content.String())
+	}
+
+	_, err = GetFS(Datasource{
+		Type: SFTP,
+		Cwd:  fmt.Sprintf("sftp://%s:wrong@%s/?known_hosts=%s", sftpTestUser, addr, knownHosts),
+	})
+	if err == nil {
+		t.Errorf("expected wrong password to be rejected")
+	}
+}
+
+func TestSftpFSCredentialsChange(t *testing.T) {
+	var pems [][]byte
+	var keys []ssh.PublicKey
+	for range 2 {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := ssh.MarshalPrivateKey(private, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pems = append(pems, pem.EncodeToMemory(block))
+		keys = append(keys, key)
+	}
+
+	addr, hostKey := startSftpServer(t, t.TempDir(), keys...)
+	cwd := fmt.Sprintf("sftp://%s@%s/?known_hosts=%s", sftpTestUser, addr, writeKnownHosts(t, addr, hostKey))
+
+	old, err := NewSftpFS(cwd, pems[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := NewSftpFS(cwd, pems[0], ""); err != nil {
+		t.Fatal(err)
+	} else if again.client != old.client {
+		t.Fatalf("expected the connection to be reused")
+	}
+
+	rotated, err := NewSftpFS(cwd, pems[1], "")
+	if err != nil {
+		t.Fatal(err)
+	} else if rotated.client == old.client {
+		t.Fatalf("expected a rotated key to dial again")
+	}
+	if _, err := old.client.Getwd(); err == nil {
+		t.Fatalf("expected the connection of the replaced key to be closed")
+	}
+	if _, err := rotated.ReadDir("/"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSftpFSUnknownHost(t *testing.T) {
+	addr, _ := startSftpServer(t, t.TempDir())
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownHosts := writeKnownHosts(t, addr, otherSigner.PublicKey())
+
+	_, err = GetFS(Datasource{
+		Type: SFTP,
+		Cwd:  fmt.Sprintf("sftp://%s:%s@%s/?known_hosts=%s", sftpTestUser, sftpTestPassword, addr, knownHosts),
+	})
+	if err == nil {
+		t.Errorf("expected mismatched host key to be rejected")
+	}
+}
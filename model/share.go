@@ -0,0 +1,101 @@
+package model
+
+import (
+	"errors"
+	"path"
+	"time"
+
+	"github.com/allape/gocrud"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrShareExpired      = errors.New("share link expired")
+	ErrShareOutOfScope   = errors.New("path is not shared")
+	ErrShareDownloadsOut = errors.New("download limit reached")
+)
+
+type ShareScope string
+
+const (
+	SharePreview  ShareScope = "preview"  // stream and view previews
+	ShareDownload ShareScope = "download" // also download as attachment and zip folders
+)
+
+// Share is a public link to Path of a datasource, Token is hashed like Session.Token
+type Share struct {
+	gocrud.Base
+	Token        string     `json:"-"            gorm:"uniqueIndex;size:64"`
+	DatasourceID gocrud.ID  `json:"datasourceId" gorm:"index"`
+	Path         string     `json:"path"`
+	IsDir        bool       `json:"isDir"`
+	Scope        ShareScope `json:"scope"        gorm:"size:16"`
+	Password     string     `json:"-"` // bcrypt hash, empty for no password
+	Protected    bool       `json:"protected"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	MaxDownloads int64      `json:"maxDownloads"` // 0 for unlimited
+	Downloads    int64      `json:"downloads"`
+	CreatedBy    gocrud.ID  `json:"createdBy"`
+}
+
+// NewShare returns the token for client and the share to be saved
+func NewShare(datasourceID gocrud.ID, file string, isDir bool, scope ShareScope, password string) (string, *Share, error) {
+	token, err := RandomToken(24)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if scope != ShareDownload {
+		scope = SharePreview
+	}
+
+	share := &Share{
+		Token:        HashToken(token),
+		DatasourceID: datasourceID,
+		Path:         file,
+		IsDir:        isDir,
+		Scope:        scope,
+	}
+
+	if password != "" {
+		share.Password, err = HashPassword(password)
+		if err != nil {
+			return "", nil, err
+		}
+		share.Protected = true
+	}
+
+	return token, share, nil
+}
+
+func (s *Share) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && now.After(*s.ExpiresAt)
+}
+
+func (s *Share) CheckPassword(password string) bool {
+	return !s.Protected || bcrypt.CompareHashAndPassword([]byte(s.Password), []byte(password)) == nil
+}
+
+// Unlocker is what a client keeps after entering the password of a protected share,
+// it changes with the password so that changing the password locks everyone out
+func (s *Share) Unlocker(token string) string {
+	return HashToken(token + ":" + s.Password)
+}
+
+// Resolve maps name, cleaned and relative to the share, to the path in datasource.
+// A file share only has "/", which is the file itself.
+func (s *Share) Resolve(name string) (string, error) {
+	name, err := CleanPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	if !s.IsDir {
+		if name != "/" {
+			return "", ErrShareOutOfScope
+		}
+		return s.Path, nil
+	}
+
+	return path.Join(s.Path, name), nil
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/allape/goview/util"
+)
+
+const (
+	SidecarSubtitleIndex   = -1
+	subtitleCacheSubFolder = "subtitles"
+)
+
+var (
+	ErrSubtitleNotFound = errors.New("subtitle not found")
+
+	// TextSubtitleCodecs are the subtitle codecs ffmpeg can convert into WebVTT,
+	// bitmap subtitles like PGS or VobSub are ignored
+	TextSubtitleCodecs = []string{
+		"subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text",
+		"microdvd", "sami", "realtext", "subviewer", "subviewer1", "jacosub",
+	}
+
+	SidecarSubtitleExts = map[string]string{
+		".srt": "subrip",
+		".ass": "ass",
+		".ssa": "ssa",
+		".vtt": "webvtt",
+	}
+)
+
+type Subtitle struct {
+	Index    int    `json:"index"`          // stream index of embedded subtitle, SidecarSubtitleIndex for sidecar file
+	File     string `json:"file,omitempty"` // path of sidecar file in datasource
+	Codec    string `json:"codec"`
+	Language string `json:"language"`
+	Title    string `json:"title"`
+	Default  bool   `json:"default"`
+	Forced   bool   `json:"forced"`
+}
+
+func (s Subtitle) IsSidecar() bool {
+	return s.Index == SidecarSubtitleIndex
+}
+
+func EmbeddedSubtitles(ffprobe *util.FFProbeJson) []Subtitle {
+	var subtitles []Subtitle
+	for _, stream := range ffprobe.Streams {
+		if stream.CodecType != util.Subtitle || !slices.Contains(TextSubtitleCodecs, stream.CodecName) {
+			continue
+		}
+		subtitles = append(subtitles, Subtitle{
+			Index:    stream.Index,
+			Codec:    stream.CodecName,
+			Language: stream.Language(),
+			Title:    stream.Title(),
+			Default:  stream.IsDefault(),
+			Forced:   stream.Disposition["forced"] == 1,
+		})
+	}
+	return subtitles
+}
+
+// SidecarSubtitles finds subtitle files next to the video,
+// e.g. movie.srt, movie.en.srt, movie.zh.Director's Cut.ass for movie.mkv
+func SidecarSubtitles(dfs DatasourceFS, video string) ([]Subtitle, error) {
+	dir := path.Dir(video)
+	base := path.Base(video)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+
+	entries, err := dfs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var subtitles []Subtitle
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		ext := path.Ext(name)
+		codec, ok := SidecarSubtitleExts[strings.ToLower(ext)]
+		if !ok {
+			continue
+		}
+
+		rest := strings.TrimSuffix(name, ext)
+		if rest != stem && !strings.HasPrefix(rest, stem+".") {
+			continue
+		}
+
+		subtitle := Subtitle{
+			Index: SidecarSubtitleIndex,
+			File:  path.Join(dir, name),
+			Codec: codec,
+		}
+
+		if labels := strings.TrimPrefix(strings.TrimPrefix(rest, stem), "."); labels != "" {
+			segments := strings.SplitN(labels, ".", 2)
+			subtitle.Language = segments[0]
+			if len(segments) > 1 {
+				subtitle.Title = segments[1]
+			}
+		}
+
+		subtitles = append(subtitles, subtitle)
+	}
+
+	return subtitles, nil
+}
+
+func withSidecarSubtitles(datasource Datasource, video string, subtitles []Subtitle) []Subtitle {
+	subtitles = slices.DeleteFunc(slices.Clone(subtitles), Subtitle.IsSidecar)
+
+	dfs, err := GetFS(datasource)
+	if err != nil {
+		l.Warn().Printf("failed to find sidecar subtitles of %s: %v", video, err)
+		return subtitles
+	}
+
+	sidecars, err := SidecarSubtitles(dfs, video)
+	if err != nil {
+		l.Warn().Printf("failed to find sidecar subtitles of %s: %v", video, err)
+		return subtitles
+	}
+
+	return append(subtitles, sidecars...)
+}
+
+var subtitleLocker = &sync.Mutex{}
+
+// SubtitleToWebVTT converts the nth subtitle of preview into WebVTT, returns the path of the cached file
+func SubtitleToWebVTT(datasource Datasource, preview Preview, nth int, cacheFolder string) (string, error) {
+	if nth < 0 || nth >= len(preview.Subtitles) {
+		return "", ErrSubtitleNotFound
+	}
+
+	subtitle := preview.Subtitles[nth]
+
+	if !subtitle.IsSidecar() {
+		dst := path.Join(cacheFolder, subtitleCacheSubFolder, preview.Digest[0:4], fmt.Sprintf("%s_%d.vtt", preview.Digest, subtitle.Index))
+		if cachedFile(dst) {
+			return dst, nil
+		}
+	}
+
+	subtitleLocker.Lock()
+	defer subtitleLocker.Unlock()
+
+	src := subtitle.File
+	if !subtitle.IsSidecar() {
+		_, src = preview.Key.Split()
+	}
+
+	tmpFile, err := CopyToTempFile(datasource, src)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+
+	digest, index := preview.Digest, subtitle.Index
+	if subtitle.IsSidecar() {
+		digest, err = util.Sha256(tmpFile)
+		if err != nil {
+			return "", err
+		}
+		index = 0
+	}
+
+	dst := path.Join(cacheFolder, subtitleCacheSubFolder, digest[0:4], fmt.Sprintf("%s_%d.vtt", digest, index))
+	if cachedFile(dst) {
+		return dst, nil
+	}
+
+	err = os.MkdirAll(path.Dir(dst), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	tmpDst := dst + ".tmp"
+	defer func() {
+		_ = os.Remove(tmpDst)
+	}()
+
+	_, err = util.FFMpegSubtitleToWebVTT(tmpDst, tmpFile.Name(), index)
+	if err != nil {
+		return "", err
+	}
+
+	return dst, os.Rename(tmpDst, dst)
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSidecarSubtitles(t *testing.T) {
+	wd := t.TempDir()
+
+	for _, name := range []string{
+		"movie.mkv",
+		"movie.srt",
+		"movie.en.srt",
+		"movie.zh.Director's Cut.ass",
+		"movie2.srt",
+		"movie.nfo",
+	} {
+		if err := os.WriteFile(path.Join(wd, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subtitles, err := SidecarSubtitles(&LocalFS{wd: wd}, "/movie.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Subtitle{
+		"/movie.srt":                   {Codec: "subrip"},
+		"/movie.en.srt":                {Codec: "subrip", Language: "en"},
+		"/movie.zh.Director's Cut.ass": {Codec: "ass", Language: "zh", Title: "Director's Cut"},
+	}
+
+	if len(subtitles) != len(expected) {
+		t.Fatalf("expected %d subtitles, got %v", len(expected), subtitles)
+	}
+
+	for _, subtitle := range subtitles {
+		e, ok := expected[subtitle.File]
+		if !ok {
+			t.Errorf("unexpected subtitle %s", subtitle.File)
+			continue
+		}
+		if !subtitle.IsSidecar() || subtitle.Codec != e.Codec || subtitle.Language != e.Language || subtitle.Title != e.Title {
+			t.Errorf("unexpected subtitle %+v for %s", subtitle, subtitle.File)
+		}
+	}
+}
+
+func TestFileKeySplit(t *testing.T) {
+	id, file := FileKey("goview://abc/a/b.mkv").Split()
+	if id != 0 || file != "" {
+		t.Errorf("expected invalid key, got %d %s", id, file)
+	}
+
+	id, file = FileKey("goview://12/a/b #1.mkv").Split()
+	if id != 12 || file != "/a/b #1.mkv" {
+		t.Errorf("unexpected split result %d %s", id, file)
+	}
+}
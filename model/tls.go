@@ -0,0 +1,165 @@
+package model
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allape/goview/env"
+)
+
+// TLSSettings of a datasource, files are paths on the server
+type TLSSettings struct {
+	CACerts            string `json:"caCerts"`    // comma separated PEM files, GOVIEW_TRUSTED_CERTS if empty
+	ClientCert         string `json:"clientCert"` // PEM file for mTLS
+	ClientKey          string `json:"clientKey"`  // PEM file of ClientCert
+	ServerName         string `json:"serverName"` // SNI and name to verify, host of Cwd if empty
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+func (s TLSSettings) caFiles() []string {
+	files := env.TrustedCertFiles()
+	if s.CACerts != "" {
+		files = nil
+		for _, file := range strings.Split(s.CACerts, ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+func (s TLSSettings) files() []string {
+	files := s.caFiles()
+	for _, file := range []string{s.ClientCert, s.ClientKey} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampFiles(files []string) (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		stamps[file] = fileStamp{modTime: stat.ModTime(), size: stat.Size()}
+	}
+	return stamps, nil
+}
+
+type tlsEntry struct {
+	stamps    map[string]fileStamp
+	config    *tls.Config
+	transport *http.Transport
+}
+
+// tlsCache keeps one config and transport per settings, so that connections are reused,
+// they are rebuilt once any of their files changes
+var tlsCache = struct {
+	sync.Mutex
+	entries map[TLSSettings]*tlsEntry
+}{
+	entries: map[TLSSettings]*tlsEntry{},
+}
+
+func (s TLSSettings) build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         s.ServerName,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+
+	if files := s.caFiles(); len(files) > 0 {
+		pool := x509.NewCertPool()
+		for _, file := range files {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate found in %s", file)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if s.ClientCert != "" || s.ClientKey != "" {
+		if s.ClientCert == "" || s.ClientKey == "" {
+			return nil, errors.New("both client certificate and key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(s.ClientCert, s.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func (s TLSSettings) entry() (*tlsEntry, error) {
+	stamps, err := stampFiles(s.files())
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCache.Lock()
+	defer tlsCache.Unlock()
+
+	cached, ok := tlsCache.entries[s]
+	if ok && maps.Equal(cached.stamps, stamps) {
+		return cached, nil
+	}
+
+	config, err := s.build()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+
+	entry := &tlsEntry{stamps: stamps, config: config, transport: transport}
+	tlsCache.entries[s] = entry
+
+	if ok {
+		l.Info().Printf("Reloaded tls files %v", s.files())
+		cached.transport.CloseIdleConnections()
+	}
+
+	return entry, nil
+}
+
+// Config returns a copy of the cached tls config, callers may change it
+func (s TLSSettings) Config() (*tls.Config, error) {
+	entry, err := s.entry()
+	if err != nil {
+		return nil, err
+	}
+	return entry.config.Clone(), nil
+}
+
+// Transport returns the shared transport of s
+func (s TLSSettings) Transport() (*http.Transport, error) {
+	entry, err := s.entry()
+	if err != nil {
+		return nil, err
+	}
+	return entry.transport, nil
+}
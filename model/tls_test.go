@@ -0,0 +1,100 @@
+package model
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestTLSSettings(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("ok"))
+	})
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+
+	writeCA := func(file string, der []byte) {
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(settings TLSSettings) error {
+		client, err := newHttpClient(settings)
+		if err != nil {
+			return err
+		}
+		res, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+
+	ca := path.Join(t.TempDir(), "ca.pem")
+	writeCA(ca, server.Certificate().Raw)
+
+	// httptest certificates are issued for example.com
+	settings := TLSSettings{CACerts: ca, ServerName: "example.com"}
+	if err := get(settings); err != nil {
+		t.Fatalf("server should be trusted with its ca: %v", err)
+	}
+
+	first, err := settings.Transport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, _ := settings.Transport(); second != first {
+		t.Fatalf("transport should be reused while files are unchanged")
+	}
+
+	if err := get(TLSSettings{ServerName: "example.com"}); err == nil {
+		t.Fatalf("server should not be trusted without its ca")
+	}
+	if err := get(TLSSettings{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("insecure should skip verification: %v", err)
+	}
+
+	// replace the bundle with an unrelated ca
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "another ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCA(ca, der)
+	if err := os.Chtimes(ca, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, _ := settings.Transport(); reloaded == first {
+		t.Fatalf("transport should be rebuilt once the bundle changes")
+	}
+	if err := get(settings); err == nil {
+		t.Fatalf("server should not be trusted after the bundle is replaced")
+	}
+
+	if _, err := (TLSSettings{ClientCert: ca}).Config(); err == nil {
+		t.Fatalf("client certificate without key should be rejected")
+	}
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/allape/gocrud"
+)
+
+// ApiTokenPrefix tells api tokens apart from session tokens in Authorization: Bearer
+const ApiTokenPrefix = "gvt_"
+
+type TokenScope string
+
+const (
+	ScopeRead     TokenScope = "read"     // browse, download and view previews
+	ScopeGenerate TokenScope = "generate" // generate and delete previews
+	ScopeAdmin    TokenScope = "admin"    // everything the user can do
+)
+
+var TokenScopes = []TokenScope{ScopeRead, ScopeGenerate, ScopeAdmin}
+
+// ApiToken is a personal access token for scripts, Token is hashed like Session.Token
+type ApiToken struct {
+	gocrud.Base
+	Name       string       `json:"name"       gorm:"size:128"`
+	Token      string       `json:"-"          gorm:"uniqueIndex;size:64"`
+	UserID     gocrud.ID    `json:"userId"     gorm:"index"`
+	Scopes     []TokenScope `json:"scopes"     gorm:"serializer:json;type:text"`
+	ExpiresAt  *time.Time   `json:"expiresAt"`
+	LastUsedAt *time.Time   `json:"lastUsedAt"`
+	LastUsedIP string       `json:"lastUsedIp" gorm:"size:64"`
+}
+
+// NewApiToken returns the token for client and the api token to be saved, ttl 0 for never expires
+func NewApiToken(user User, name string, scopes []TokenScope, ttl time.Duration) (string, *ApiToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(TokenScopes, scope) {
+			return "", nil, fmt.Errorf("unknown scope %s", scope)
+		}
+	}
+
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token = ApiTokenPrefix + token
+
+	apiToken := &ApiToken{
+		Name:   strings.TrimSpace(name),
+		Token:  HashToken(token),
+		UserID: user.ID,
+		Scopes: slices.Compact(slices.Sorted(slices.Values(scopes))),
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	return token, apiToken, nil
+}
+
+func (t *ApiToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+func (t *ApiToken) Has(scope TokenScope) bool {
+	return slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, ScopeAdmin)
+}
+
+// Actions is the upper bound of what the token can do, the user's ACL still applies
+func (t *ApiToken) Actions() Action {
+	var actions Action
+	if t.Has(ScopeRead) {
+		actions |= ActionList | ActionRead
+	}
+	if t.Has(ScopeGenerate) {
+		actions |= ActionGenerate
+	}
+	if t.Has(ScopeAdmin) {
+		actions |= ActionWrite | ActionAdmin
+	}
+	return actions
+}
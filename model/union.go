@@ -0,0 +1,312 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/allape/gocrud"
+)
+
+type UnionPrefer string
+
+const (
+	UnionPreferFirst  UnionPrefer = "first"  // the first source listed wins
+	UnionPreferNewest UnionPrefer = "newest" // the most recently modified file wins
+)
+
+const maxUnionDepth = 8
+
+// DatasourceLoader loads member datasources of a union, set by the controller
+var DatasourceLoader func(id gocrud.ID) (Datasource, error)
+
+type UnionConfig struct {
+	Sources []gocrud.ID
+	Prefer  UnionPrefer
+}
+
+// ParseUnionConfig parses union://?sources=3,1,2&prefer=first
+func ParseUnionConfig(cwd string) (*UnionConfig, error) {
+	u, err := url.Parse(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "union" {
+		return nil, fmt.Errorf("union: unsupported scheme %s", u.Scheme)
+	}
+
+	query := u.Query()
+
+	config := &UnionConfig{
+		Sources: gocrud.IDsFromCommaSeparatedString(query.Get("sources")),
+		Prefer:  UnionPrefer(query.Get("prefer")),
+	}
+
+	if len(config.Sources) == 0 {
+		return nil, errors.New("union: no sources")
+	}
+
+	switch config.Prefer {
+	case "":
+		config.Prefer = UnionPreferFirst
+	case UnionPreferFirst, UnionPreferNewest:
+	default:
+		return nil, fmt.Errorf("union: unsupported prefer %s", config.Prefer)
+	}
+
+	return config, nil
+}
+
+type unionMember struct {
+	datasource Datasource
+	fs         DatasourceFS
+}
+
+// UnionDirEntry remembers which datasource an entry of a union comes from
+type UnionDirEntry struct {
+	fs.DirEntry
+	Source Datasource
+}
+
+type UnionFS struct {
+	DatasourceFS
+	members []unionMember
+	prefer  UnionPrefer
+}
+
+type cachedUnion struct {
+	cwd       string
+	updatedAt time.Time
+	union     *UnionFS
+}
+
+// unionCache keeps the built UnionFS of each union datasource,
+// an entry is rebuilt once its datasource is edited, and dropped entirely by ForgetUnionFS
+var unionCache = struct {
+	sync.Mutex
+	unions map[gocrud.ID]cachedUnion
+}{
+	unions: map[gocrud.ID]cachedUnion{},
+}
+
+// ForgetUnionFS drops every cached union, members of a union may have changed after any datasource is saved or deleted
+func ForgetUnionFS() {
+	unionCache.Lock()
+	defer unionCache.Unlock()
+
+	clear(unionCache.unions)
+}
+
+func NewUnionFS(datasource Datasource) (*UnionFS, error) {
+	unionCache.Lock()
+	cached, ok := unionCache.unions[datasource.ID]
+	unionCache.Unlock()
+
+	if ok && cached.cwd == datasource.Cwd && cached.updatedAt.Equal(datasource.UpdatedAt) {
+		return cached.union, nil
+	}
+
+	union, err := newUnionFS(datasource, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	unionCache.Lock()
+	unionCache.unions[datasource.ID] = cachedUnion{
+		cwd:       datasource.Cwd,
+		updatedAt: datasource.UpdatedAt,
+		union:     union,
+	}
+	unionCache.Unlock()
+
+	return union, nil
+}
+
+func newUnionFS(datasource Datasource, parents []gocrud.ID) (*UnionFS, error) {
+	if DatasourceLoader == nil {
+		return nil, errors.New("union: datasource loader is not set")
+	}
+
+	if slices.Contains(parents, datasource.ID) {
+		return nil, fmt.Errorf("union: datasource %d references itself", datasource.ID)
+	}
+	if len(parents) >= maxUnionDepth {
+		return nil, fmt.Errorf("union: datasource %d is nested deeper than %d unions", datasource.ID, maxUnionDepth)
+	}
+	parents = append(parents, datasource.ID)
+
+	config, err := ParseUnionConfig(datasource.Cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	union := &UnionFS{prefer: config.Prefer}
+
+	for _, id := range config.Sources {
+		member, err := DatasourceLoader(id)
+		if err != nil {
+			return nil, fmt.Errorf("union: source %d: %w", id, err)
+		}
+
+		var dfs DatasourceFS
+		if member.Type == UNION {
+			dfs, err = newUnionFS(member, parents)
+		} else {
+			dfs, err = GetFS(member)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("union: source %d: %w", id, err)
+		}
+
+		union.members = append(union.members, unionMember{datasource: member, fs: dfs})
+	}
+
+	return union, nil
+}
+
+// resolve finds the member holding name
+func (f *UnionFS) resolve(name string) (*unionMember, fs.FileInfo, error) {
+	var (
+		found   *unionMember
+		info    fs.FileInfo
+		lastErr error = fs.ErrNotExist
+	)
+
+	for i := range f.members {
+		member := &f.members[i]
+
+		stat, err := member.fs.Stat(name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if found == nil || f.prefer == UnionPreferNewest && !info.IsDir() && !stat.IsDir() && stat.ModTime().After(info.ModTime()) {
+			found = member
+			info = stat
+		}
+
+		if f.prefer == UnionPreferFirst || stat.IsDir() {
+			break
+		}
+	}
+
+	if found == nil {
+		return nil, nil, lastErr
+	}
+
+	return found, info, nil
+}
+
+// Resolve returns the underlying datasource which serves name
+func (f *UnionFS) Resolve(name string) (Datasource, error) {
+	member, _, err := f.resolve(name)
+	if err != nil {
+		return Datasource{}, err
+	}
+
+	if union, ok := member.fs.(*UnionFS); ok {
+		return union.Resolve(name)
+	}
+
+	return member.datasource, nil
+}
+
+func (f *UnionFS) Open(name string) (File, error) {
+	member, _, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return member.fs.Open(name)
+}
+
+func (f *UnionFS) Stat(name string) (fs.FileInfo, error) {
+	_, info, err := f.resolve(name)
+	return info, err
+}
+
+// ReadDir merges entries of all members, folders with the same name are merged on the next ReadDir,
+// other conflicts are settled by prefer the same way as resolve does
+func (f *UnionFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var (
+		entries []fs.DirEntry
+		indexes = map[string]int{}
+		found   bool
+		lastErr error = fs.ErrNotExist
+	)
+
+	for _, member := range f.members {
+		children, err := member.fs.ReadDir(name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		found = true
+
+		for _, child := range children {
+			entry := UnionDirEntry{DirEntry: child, Source: member.datasource}
+			if sourced, ok := child.(UnionDirEntry); ok {
+				entry = sourced
+			}
+
+			index, exists := indexes[child.Name()]
+			if !exists {
+				indexes[child.Name()] = len(entries)
+				entries = append(entries, entry)
+				continue
+			}
+
+			if f.replaces(entries[index], entry) {
+				entries[index] = entry
+			}
+		}
+	}
+
+	if !found {
+		return nil, lastErr
+	}
+
+	return entries, nil
+}
+
+func (f *UnionFS) replaces(existing, entry fs.DirEntry) bool {
+	if f.prefer != UnionPreferNewest || existing.IsDir() || entry.IsDir() {
+		return false
+	}
+
+	existingInfo, err := existing.Info()
+	if err != nil {
+		return true
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+
+	return info.ModTime().After(existingInfo.ModTime())
+}
+
+// ResolveDatasource returns the datasource which actually holds file,
+// datasource itself is returned if it is not a union or file can not be resolved
+func ResolveDatasource(datasource Datasource, file string) Datasource {
+	if datasource.Type != UNION {
+		return datasource
+	}
+
+	union, err := NewUnionFS(datasource)
+	if err != nil {
+		return datasource
+	}
+
+	source, err := union.Resolve(file)
+	if err != nil {
+		return datasource
+	}
+
+	return source
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allape/gocrud"
+)
+
+func TestUnionFS(t *testing.T) {
+	older, newer := t.TempDir(), t.TempDir()
+
+	files := map[string]string{
+		path.Join(older, "2023", "a.jpg"): "2023",
+		path.Join(older, "same.jpg"):      "older",
+		path.Join(newer, "2024", "b.jpg"): "2024",
+		path.Join(newer, "same.jpg"):      "newer",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(path.Join(older, "same.jpg"), time.Now(), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	datasources := map[gocrud.ID]Datasource{
+		1: {Base: gocrud.Base{ID: 1}, Type: LOCAL, Cwd: older},
+		2: {Base: gocrud.Base{ID: 2}, Type: LOCAL, Cwd: newer},
+		3: {Base: gocrud.Base{ID: 3}, Type: UNION, Cwd: "union://?sources=1,2"},
+		4: {Base: gocrud.Base{ID: 4}, Type: UNION, Cwd: "union://?sources=1,2&prefer=newest"},
+		5: {Base: gocrud.Base{ID: 5}, Type: UNION, Cwd: "union://?sources=1,5"},
+	}
+	DatasourceLoader = func(id gocrud.ID) (Datasource, error) {
+		datasource, ok := datasources[id]
+		if !ok {
+			return Datasource{}, errors.New("not found")
+		}
+		return datasource, nil
+	}
+	defer func() {
+		DatasourceLoader = nil
+		ForgetUnionFS()
+	}()
+	ForgetUnionFS()
+
+	dfs, err := GetFS(datasources[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := dfs.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 merged entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Name() == "same.jpg" && entry.(UnionDirEntry).Source.ID != 1 {
+			t.Errorf("expected same.jpg from the first source")
+		}
+	}
+
+	if source := ResolveDatasource(datasources[3], "/2024/b.jpg"); source.ID != 2 {
+		t.Errorf("expected /2024/b.jpg to resolve to datasource 2, got %d", source.ID)
+	}
+	if source := ResolveDatasource(datasources[3], "/same.jpg"); source.ID != 1 {
+		t.Errorf("expected /same.jpg to resolve to datasource 1, got %d", source.ID)
+	}
+	if source := ResolveDatasource(datasources[4], "/same.jpg"); source.ID != 2 {
+		t.Errorf("expected newest /same.jpg to resolve to datasource 2, got %d", source.ID)
+	}
+
+	if _, err := GetFS(datasources[5]); err == nil || !strings.Contains(err.Error(), "references itself") {
+		t.Errorf("expected error for self referencing union, got %v", err)
+	}
+
+	// a chain of unions deeper than maxUnionDepth
+	for id := gocrud.ID(10); id <= 10+maxUnionDepth; id++ {
+		datasources[id] = Datasource{Base: gocrud.Base{ID: id}, Type: UNION, Cwd: fmt.Sprintf("union://?sources=%d", id+1)}
+	}
+	datasources[11+maxUnionDepth] = datasources[1]
+	if _, err := GetFS(datasources[10]); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Errorf("expected error for deeply nested union, got %v", err)
+	}
+}
+
+func TestUnionFSCache(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+
+	loads := 0
+	datasources := map[gocrud.ID]Datasource{
+		1: {Base: gocrud.Base{ID: 1}, Type: LOCAL, Cwd: first},
+		2: {Base: gocrud.Base{ID: 2}, Type: LOCAL, Cwd: second},
+		3: {Base: gocrud.Base{ID: 3}, Type: UNION, Cwd: "union://?sources=1"},
+	}
+	DatasourceLoader = func(id gocrud.ID) (Datasource, error) {
+		loads++
+		return datasources[id], nil
+	}
+	defer func() {
+		DatasourceLoader = nil
+		ForgetUnionFS()
+	}()
+	ForgetUnionFS()
+
+	union, err := NewUnionFS(datasources[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := NewUnionFS(datasources[3]); err != nil {
+		t.Fatal(err)
+	} else if cached != union || loads != 1 {
+		t.Fatalf("expected union to be built once, loaded %d members", loads)
+	}
+
+	// edited union
+	edited := datasources[3]
+	edited.Cwd = "union://?sources=1,2"
+	edited.UpdatedAt = time.Now()
+	if rebuilt, err := NewUnionFS(edited); err != nil {
+		t.Fatal(err)
+	} else if rebuilt == union || len(rebuilt.members) != 2 {
+		t.Fatalf("expected edited union to be rebuilt")
+	}
+
+	// saving any datasource may change members
+	loads = 0
+	ForgetUnionFS()
+	if _, err := NewUnionFS(edited); err != nil {
+		t.Fatal(err)
+	} else if loads != 2 {
+		t.Fatalf("expected forgotten union to be rebuilt, loaded %d members", loads)
+	}
+}
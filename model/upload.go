@@ -0,0 +1,140 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+)
+
+var (
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadInProgress     = errors.New("another request is uploading the same file")
+)
+
+// uploadsInProgress are the staging files being appended to or committed,
+// requests for a busy file are turned down instead of waiting for a client that may be slow
+var uploadsInProgress = struct {
+	sync.Mutex
+	files map[string]bool
+}{
+	files: map[string]bool{},
+}
+
+// claimUpload marks staging as busy until the returned func is called
+func claimUpload(staging string) (func(), error) {
+	uploadsInProgress.Lock()
+	defer uploadsInProgress.Unlock()
+
+	if uploadsInProgress.files[staging] {
+		return nil, ErrUploadInProgress
+	}
+	uploadsInProgress.files[staging] = true
+
+	return func() {
+		uploadsInProgress.Lock()
+		defer uploadsInProgress.Unlock()
+		delete(uploadsInProgress.files, staging)
+	}, nil
+}
+
+// uploadStagingFile is where chunks of a resumable upload are collected before committed to datasource
+func uploadStagingFile(cacheFolder string, datasource Datasource, name string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", datasource.ID, path.Clean("/"+name))))
+	return path.Join(cacheFolder, "uploads", hex.EncodeToString(sum[:])+".part")
+}
+
+// UploadedOffset returns the count of bytes received for name so far
+func UploadedOffset(cacheFolder string, datasource Datasource, name string) (int64, error) {
+	stat, err := os.Stat(uploadStagingFile(cacheFolder, datasource, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// AppendUploadChunk appends reader to the staged upload of name, offset must equal to the received size,
+// returns the received size after appending
+func AppendUploadChunk(cacheFolder string, datasource Datasource, name string, offset int64, reader io.Reader) (int64, error) {
+	staging := uploadStagingFile(cacheFolder, datasource, name)
+
+	release, err := claimUpload(staging)
+	if err != nil {
+		size, _ := UploadedOffset(cacheFolder, datasource, name)
+		return size, err
+	}
+	defer release()
+
+	if err := os.MkdirAll(path.Dir(staging), 0755); err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(staging, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if offset == 0 && size > 0 {
+		// restarted from scratch
+		if err := file.Truncate(0); err != nil {
+			return 0, err
+		}
+		size, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if offset != size {
+		return size, ErrUploadOffsetMismatch
+	}
+
+	n, err := io.Copy(file, reader)
+	return size + n, err
+}
+
+// CommitUpload writes the staged upload of name into datasource
+func CommitUpload(cacheFolder string, datasource Datasource, name string) (int64, error) {
+	wfs, err := GetWritableFS(datasource)
+	if err != nil {
+		return 0, err
+	}
+
+	staging := uploadStagingFile(cacheFolder, datasource, name)
+
+	release, err := claimUpload(staging)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	file, err := os.Open(staging)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	n, err := wfs.WriteFile(name, file)
+	if err != nil {
+		return n, err
+	}
+
+	_ = file.Close()
+	return n, os.Remove(staging)
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/allape/gocrud"
+)
+
+func TestChunkedUpload(t *testing.T) {
+	wd, cache := t.TempDir(), t.TempDir()
+	datasource := Datasource{Base: gocrud.Base{ID: 1}, Type: LOCAL, Cwd: wd}
+
+	wfs, err := GetWritableFS(datasource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wfs.Mkdir("/uploads"); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "/uploads/a.txt"
+
+	offset, err := AppendUploadChunk(cache, datasource, name, 0, strings.NewReader("hello "))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AppendUploadChunk(cache, datasource, name, 3, strings.NewReader("lo ")); !errors.Is(err, ErrUploadOffsetMismatch) {
+		t.Errorf("expected offset mismatch, got %v", err)
+	}
+
+	if received, err := UploadedOffset(cache, datasource, name); err != nil || received != offset {
+		t.Errorf("expected received offset %d, got %d %v", offset, received, err)
+	}
+
+	// a slow client holds its own file only
+	slow, writer := io.Pipe()
+	appended := make(chan error)
+	go func() {
+		_, err := AppendUploadChunk(cache, datasource, "/uploads/slow.txt", 0, slow)
+		appended <- err
+	}()
+	_, _ = writer.Write([]byte("slow"))
+
+	if _, err := AppendUploadChunk(cache, datasource, "/uploads/slow.txt", 4, strings.NewReader("er")); !errors.Is(err, ErrUploadInProgress) {
+		t.Errorf("expected the slow file to be busy, got %v", err)
+	}
+	if _, err := CommitUpload(cache, datasource, "/uploads/slow.txt"); !errors.Is(err, ErrUploadInProgress) {
+		t.Errorf("expected the slow file not to be committed while appending, got %v", err)
+	}
+
+	if _, err := AppendUploadChunk(cache, datasource, name, offset, strings.NewReader("world")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CommitUpload(cache, datasource, name); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = writer.Close()
+	if err := <-appended; err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path.Join(wd, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "hello world" {
+		t.Errorf("unexpected content %s", content)
+	}
+
+	if received, _ := UploadedOffset(cache, datasource, name); received != 0 {
+		t.Errorf("expected staging file to be removed")
+	}
+
+	if err := wfs.Rename("/uploads", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wfs.Remove("/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(wd, "moved")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected /moved to be removed")
+	}
+
+	if _, err := GetWritableFS(Datasource{Type: S3, Cwd: "s3://127.0.0.1/bucket"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected s3 to be read-only, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/allape/gocrud"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+type User struct {
+	gocrud.Base
+	Username string `json:"username" gorm:"uniqueIndex;size:128"`
+	Password string `json:"password,omitempty"` // bcrypt hash, cleared before sent to client
+	Admin    bool   `json:"admin"`
+	Disabled bool   `json:"disabled"`
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (u *User) CheckPassword(password string) bool {
+	return u.Password != "" && bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+// Session is a login, Token is the sha256 of what is handed to client, so a leaked database can not be replayed
+type Session struct {
+	gocrud.Base
+	Token     string    `json:"-"         gorm:"uniqueIndex;size:64"`
+	UserID    gocrud.ID `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns a url safe random string with n bytes of entropy
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewSession returns the token for client and the session to be saved
+func NewSession(user User, ttl time.Duration) (string, *Session, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &Session{
+		Token:     HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
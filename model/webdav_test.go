@@ -0,0 +1,121 @@
+package model
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestWebdavFS(t *testing.T) {
+	wd := t.TempDir()
+	if err := os.MkdirAll(path.Join(wd, "albums", "2024"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(wd, "albums", "cover image.jpg"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.Dir(wd),
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if username, password, ok := request.BasicAuth(); !ok || username != "goview" || password != "secret" {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="goview"`)
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// like most servers, collections are only found with a trailing slash
+		if request.Method == "PROPFIND" && !strings.HasSuffix(request.URL.Path, "/") {
+			if stat, err := os.Stat(path.Join(wd, strings.TrimPrefix(request.URL.Path, "/dav"))); err == nil && stat.IsDir() {
+				http.Redirect(writer, request, request.URL.Path+"/", http.StatusMovedPermanently)
+				return
+			}
+		}
+		handler.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+
+	cwd, err := url.Parse(server.URL + "/dav/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd.User = url.UserPassword("goview", "secret")
+
+	dfs, err := NewWebdavFS(cwd.String(), server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := dfs.ReadDir("/albums")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, entry := range entries {
+		found[entry.Name()] = entry.IsDir()
+	}
+	if len(found) != 2 || !found["2024"] || found["cover image.jpg"] {
+		t.Fatalf("unexpected entries %v", found)
+	}
+
+	file, err := dfs.Open("/albums/cover image.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	} else if stat.Size() != 10 || stat.IsDir() {
+		t.Errorf("unexpected stat %d %v", stat.Size(), stat.IsDir())
+	}
+
+	content := &strings.Builder{}
+	if _, err := file.WriteTo(content); err != nil {
+		t.Fatal(err)
+	} else if content.String() != "0123456789" {
+		t.Errorf("unexpected content %q", content.String())
+	}
+
+	buf := make([]byte, 4)
+	if _, err := file.(io.ReaderAt).ReadAt(buf, 3); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != "3456" {
+		t.Errorf("unexpected ranged content %q", buf)
+	}
+
+	if stat, err := dfs.Stat("/albums/2024"); err != nil {
+		t.Fatal(err)
+	} else if !stat.IsDir() || stat.Name() != "2024" {
+		t.Errorf("unexpected stat of collection %s %v", stat.Name(), stat.IsDir())
+	}
+
+	again, err := NewWebdavFS(cwd.String(), server.Client())
+	if err != nil {
+		t.Fatal(err)
+	} else if again.client.Transport != dfs.client.Transport {
+		t.Errorf("expected the authenticating transport to be reused")
+	}
+
+	if _, err := dfs.Stat("/missing.jpg"); err == nil {
+		t.Errorf("expected missing file to fail")
+	}
+
+	unauthorized, err := NewWebdavFS(server.URL+"/dav/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unauthorized.ReadDir("/"); err == nil {
+		t.Errorf("expected request without credentials to fail")
+	}
+}
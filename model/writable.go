@@ -0,0 +1,132 @@
+package model
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/allape/gohtvfs"
+)
+
+var ErrReadOnly = errors.New("datasource is read-only")
+
+// WritableFS is implemented by datasources which can be modified
+type WritableFS interface {
+	DatasourceFS
+	// WriteFile creates or truncates name with the content of reader
+	WriteFile(name string, reader io.Reader) (int64, error)
+	Mkdir(name string) error
+	Rename(oldname, newname string) error
+	// Remove deletes name, folders are removed recursively
+	Remove(name string) error
+}
+
+// GetWritableFS returns the filesystem of datasource if it supports writing,
+// paths inside archives or unions are never writable
+func GetWritableFS(datasource Datasource) (WritableFS, error) {
+	if datasource.Type == UNION {
+		return nil, ErrReadOnly
+	}
+
+	dfs, err := getFS(datasource)
+	if err != nil {
+		return nil, err
+	}
+
+	wfs, ok := dfs.(WritableFS)
+	if !ok {
+		return nil, ErrReadOnly
+	}
+
+	return wfs, nil
+}
+
+func (f *LocalFS) WriteFile(name string, reader io.Reader) (int64, error) {
+	file, err := retryOnStaleRoot(f, func() (*os.File, error) {
+		root, name, err := f.root(name)
+		if err != nil {
+			return nil, err
+		}
+		return root.Create(name)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return n, err
+}
+
+func (f *LocalFS) Mkdir(name string) error {
+	_, err := retryOnStaleRoot(f, func() (any, error) {
+		root, name, err := f.root(name)
+		if err != nil {
+			return nil, err
+		}
+		return nil, root.Mkdir(name, 0755)
+	})
+	return err
+}
+
+func (f *LocalFS) Rename(oldname, newname string) error {
+	_, err := retryOnStaleRoot(f, func() (any, error) {
+		root, oldname, err := f.root(oldname)
+		if err != nil {
+			return nil, err
+		}
+		_, newname, err := f.root(newname)
+		if err != nil {
+			return nil, err
+		}
+		return nil, root.Rename(oldname, newname)
+	})
+	return err
+}
+
+func (f *LocalFS) Remove(name string) error {
+	_, err := retryOnStaleRoot(f, func() (any, error) {
+		root, name, err := f.root(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "." {
+			return nil, ErrInvalidPath
+		}
+		if _, err := root.Lstat(name); err != nil {
+			return nil, err
+		}
+		return nil, root.RemoveAll(name)
+	})
+	return err
+}
+
+// dufsName avoids the trailing slash gohtvfs appends to absolute names, which is meant for folders
+func dufsName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func (f *DuFS) WriteFile(name string, reader io.Reader) (int64, error) {
+	file, err := f.dufs.Open(dufsName(name))
+	if err != nil {
+		return 0, err
+	}
+	return file.(*gohtvfs.DufsFile).ReadFrom(reader)
+}
+
+func (f *DuFS) Mkdir(name string) error {
+	return f.dufs.Mkdir(dufsName(name), 0755)
+}
+
+func (f *DuFS) Rename(oldname, newname string) error {
+	return f.dufs.Rename(dufsName(oldname), dufsName(newname))
+}
+
+func (f *DuFS) Remove(name string) error {
+	return f.dufs.Remove(dufsName(name))
+}
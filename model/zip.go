@@ -0,0 +1,120 @@
+package model
+
+import (
+	"archive/zip"
+	"io"
+	"path"
+	"strings"
+)
+
+// StoredExts are already compressed, deflating them again only costs cpu
+var StoredExts = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".heif", ".avif",
+	".mp4", ".m4v", ".mkv", ".mov", ".avi", ".webm", ".wmv", ".flv", ".ts",
+	".mp3", ".m4a", ".aac", ".flac", ".ogg", ".opus",
+	".zip", ".cbz", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar",
+	".pdf", ".docx", ".xlsx", ".pptx", ".epub",
+}
+
+func isStored(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, stored := range StoredExts {
+		if ext == stored {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteZip streams files under root into writer as a zip,
+// paths are relative to root and default to root itself, folders are added recursively
+func WriteZip(dfs DatasourceFS, writer io.Writer, root string, paths []string) error {
+	archive := zip.NewWriter(writer)
+
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	for _, name := range paths {
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+		stat, err := dfs.Stat(path.Join(root, name))
+		if err != nil {
+			return err
+		}
+
+		if stat.IsDir() {
+			err = writeZipDir(dfs, archive, root, name)
+		} else {
+			err = writeZipFile(dfs, archive, root, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeZipDir(dfs DatasourceFS, archive *zip.Writer, root, dir string) error {
+	entries, err := dfs.ReadDir(path.Join(root, dir))
+	if err != nil {
+		return err
+	}
+
+	if dir != "" {
+		if _, err := archive.Create(dir + "/"); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			err = writeZipDir(dfs, archive, root, name)
+		} else {
+			err = writeZipFile(dfs, archive, root, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeZipFile(dfs DatasourceFS, archive *zip.Writer, root, name string) error {
+	file, err := dfs.Open(path.Join(root, name))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	} else if stat.IsDir() {
+		// symlinked folder, not followed to avoid loops
+		return nil
+	}
+
+	header := &zip.FileHeader{
+		Name:     name,
+		Modified: stat.ModTime(),
+		Method:   zip.Deflate,
+	}
+	header.SetMode(0644)
+	if isStored(name) {
+		header.Method = zip.Store
+	}
+
+	w, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteTo(w)
+	return err
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWriteZip(t *testing.T) {
+	wd := t.TempDir()
+
+	for name, content := range map[string]string{
+		"shoot/notes.txt":     "notes",
+		"shoot/raw/0001.jpg":  "jpeg",
+		"shoot/raw/0002.jpg":  "jpeg",
+		"other/unrelated.txt": "nope",
+	} {
+		if err := os.MkdirAll(path.Join(wd, path.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(wd, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dfs := &LocalFS{wd: wd}
+
+	zipped := func(paths ...string) map[string]*zip.File {
+		buf := &bytes.Buffer{}
+		if err := WriteZip(dfs, buf, "/shoot", paths); err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string]*zip.File{}
+		for _, file := range reader.File {
+			files[file.Name] = file
+		}
+		return files
+	}
+
+	files := zipped()
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "notes.txt,raw/,raw/0001.jpg,raw/0002.jpg" {
+		t.Errorf("unexpected entries %v", names)
+	}
+
+	if files["raw/0001.jpg"].Method != zip.Store {
+		t.Errorf("expected jpg to be stored")
+	}
+	if files["notes.txt"].Method != zip.Deflate {
+		t.Errorf("expected txt to be deflated")
+	}
+
+	files = zipped("raw/0002.jpg", "../notes.txt")
+	if len(files) != 2 || files["raw/0002.jpg"] == nil || files["notes.txt"] == nil {
+		t.Errorf("unexpected selection %v", files)
+	}
+}
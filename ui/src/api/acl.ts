@@ -0,0 +1,13 @@
+import Crudy from "@allape/gocrud-react";
+import { SERVER_URL } from "@allape/gocrud-react/src/config";
+import { IGroup, IGroupMember, IPermission } from "../model/acl.ts";
+
+export const GroupCrudy = new Crudy<IGroup>(`${SERVER_URL}/group`);
+
+export const GroupMemberCrudy = new Crudy<IGroupMember>(
+  `${SERVER_URL}/group-member`,
+);
+
+export const PermissionCrudy = new Crudy<IPermission>(
+  `${SERVER_URL}/permission`,
+);
@@ -0,0 +1,21 @@
+import Crudy from "@allape/gocrud-react";
+import { SERVER_URL } from "@allape/gocrud-react/src/config";
+import IAuditEvent, { IAuditSearchParams } from "../model/audit.ts";
+import { URLString } from "./common.ts";
+
+export const AuditCrudy = new Crudy<IAuditEvent>(`${SERVER_URL}/audit`);
+
+export function getAuditExportURL(params: IAuditSearchParams): URLString {
+  const query = new URLSearchParams();
+  Object.entries(params).forEach(([key, value]) => {
+    if (value === undefined || value === "") {
+      return;
+    }
+    if (Array.isArray(value)) {
+      value.forEach((v) => query.append(key, `${v}`));
+    } else {
+      query.append(key, `${value}`);
+    }
+  });
+  return `${SERVER_URL}/audit/export?${query.toString()}`;
+}
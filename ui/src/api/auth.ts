@@ -0,0 +1,32 @@
+import Crudy, { get } from "@allape/gocrud-react";
+import { SERVER_URL } from "@allape/gocrud-react/src/config";
+import IUser, { ILoginResult } from "../model/user.ts";
+
+export const UserCrudy = new Crudy<IUser>(`${SERVER_URL}/user`);
+
+export function login(
+  username: string,
+  password: string,
+): Promise<ILoginResult> {
+  return get(`${SERVER_URL}/auth/login`, {
+    method: "POST",
+    body: JSON.stringify({ username, password }),
+  });
+}
+
+export function logout(): Promise<boolean> {
+  return get(`${SERVER_URL}/auth/logout`, {
+    method: "POST",
+  });
+}
+
+export function me(): Promise<IUser> {
+  return get(`${SERVER_URL}/auth/me`);
+}
+
+export function changePassword(old: string, password: string): Promise<boolean> {
+  return get(`${SERVER_URL}/auth/password`, {
+    method: "POST",
+    body: JSON.stringify({ old, new: password }),
+  });
+}
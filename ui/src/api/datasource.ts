@@ -1,6 +1,9 @@
 import Crudy, { get } from "@allape/gocrud-react";
 import { SERVER_URL } from "@allape/gocrud-react/src/config";
-import IDatasource, { IFileInfo } from "../model/datasource.ts";
+import IDatasource, {
+  IConnectivityResult,
+  IFileInfo,
+} from "../model/datasource.ts";
 import IPreview from "../model/preview.ts";
 import { URLString } from "./common.ts";
 
@@ -8,6 +11,23 @@ export const DatasourceCrudy = new Crudy<IDatasource>(
   `${SERVER_URL}/datasource`,
 );
 
+export function testConnection(
+  datasource: Partial<IDatasource>,
+): Promise<IConnectivityResult> {
+  return get(`${SERVER_URL}/datasource/test`, {
+    method: "POST",
+    body: JSON.stringify(datasource),
+  });
+}
+
+export function checkHealth(
+  id: IDatasource["id"],
+): Promise<IConnectivityResult> {
+  return get(`${SERVER_URL}/datasource/check/${id}`, {
+    method: "POST",
+  });
+}
+
 export function readDir(
   id: IDatasource["id"],
   wd: string,
@@ -25,3 +45,49 @@ export function getFileURLFromDatasource(
 export function getFileURLByKey(key: IPreview["key"]): URLString {
   return `${SERVER_URL}/datasource/by-key/${encodeURIComponent(key)}`;
 }
+
+export function uploadFiles(
+  id: IDatasource["id"],
+  wd: string,
+  files: File[],
+): Promise<string[]> {
+  const body = new FormData();
+  files.forEach((file) => body.append("file", file));
+  return get(`${SERVER_URL}/datasource/upload/${id}${wd}`, {
+    method: "POST",
+    body,
+  });
+}
+
+export function mkdir(id: IDatasource["id"], wd: string): Promise<boolean> {
+  return get(`${SERVER_URL}/datasource/mkdir/${id}${wd}`, {
+    method: "POST",
+  });
+}
+
+export function rename(
+  id: IDatasource["id"],
+  from: string,
+  to: string,
+): Promise<string> {
+  return get(`${SERVER_URL}/datasource/rename/${id}${from}`, {
+    method: "POST",
+    body: JSON.stringify({ to }),
+  });
+}
+
+export function remove(id: IDatasource["id"], wd: string): Promise<boolean> {
+  return get(`${SERVER_URL}/datasource/remove/${id}${wd}`, {
+    method: "DELETE",
+  });
+}
+
+export function getZipURL(
+  id: IDatasource["id"],
+  wd: string,
+  paths: string[] = [],
+): URLString {
+  const params = new URLSearchParams();
+  paths.forEach((path) => params.append("path", path));
+  return `${SERVER_URL}/datasource/zip/${id}${wd || "/"}?${params.toString()}`;
+}
@@ -0,0 +1,40 @@
+import { SERVER_URL } from "@allape/gocrud-react/src/config";
+import IDatasource from "../model/datasource.ts";
+import IPreview from "../model/preview.ts";
+import { URLString } from "./common.ts";
+
+export type ImageFit = "contain" | "cover" | "fill";
+export type ImageFormat = "jpeg" | "webp" | "png";
+
+export interface IResizeOptions {
+  w?: number;
+  h?: number;
+  fit?: ImageFit;
+  format?: ImageFormat;
+  q?: number;
+}
+
+function toQuery(options: IResizeOptions): string {
+  const params = new URLSearchParams();
+  Object.entries(options).forEach(([key, value]) => {
+    if (value !== undefined && value !== null) {
+      params.set(key, `${value}`);
+    }
+  });
+  return params.toString();
+}
+
+export function getResizedImageURLByDatasource(
+  id: IDatasource["id"],
+  filename: string,
+  options: IResizeOptions,
+): URLString {
+  return `${SERVER_URL}/image/by-ds/${id}${filename}?${toQuery(options)}`;
+}
+
+export function getResizedCoverURLByKey(
+  key: IPreview["key"],
+  options: IResizeOptions,
+): URLString {
+  return `${SERVER_URL}/image/by-key/${encodeURIComponent(key)}?${toQuery(options)}`;
+}
@@ -25,3 +25,14 @@ export function getPreviewURLByDatasource(
 export function getPreviewURLByKey(key: IPreview["key"]): URLString {
   return `${SERVER_URL}/preview/by-key/${encodeURIComponent(key)}`;
 }
+
+export function getPosterURLByKey(key: IPreview["key"]): URLString {
+  return `${SERVER_URL}/preview/poster/by-key/${encodeURIComponent(key)}`;
+}
+
+export function getSubtitleURL(
+  id: IPreview["id"],
+  nth: number,
+): URLString {
+  return `${SERVER_URL}/preview/subtitle/${id}/${nth}.vtt`;
+}
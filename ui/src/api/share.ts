@@ -0,0 +1,53 @@
+import Crudy, { get } from "@allape/gocrud-react";
+import { SERVER_URL } from "@allape/gocrud-react/src/config";
+import IDatasource, { IFileInfo } from "../model/datasource.ts";
+import IShare, {
+  IShareBody,
+  IShareInfo,
+  IShareResult,
+} from "../model/share.ts";
+import { URLString } from "./common.ts";
+
+export const ShareCrudy = new Crudy<IShare>(`${SERVER_URL}/share`);
+
+export function createShare(
+  id: IDatasource["id"],
+  wd: string,
+  body: IShareBody,
+): Promise<IShareResult> {
+  return get(`${SERVER_URL}/share/create/${id}${wd}`, {
+    method: "POST",
+    body: JSON.stringify(body),
+  });
+}
+
+export function getShareInfo(token: string): Promise<IShareInfo> {
+  return get(`${SERVER_URL}/public/share/${token}`);
+}
+
+export function unlockShare(token: string, password: string): Promise<boolean> {
+  return get(`${SERVER_URL}/public/share/${token}/unlock`, {
+    method: "POST",
+    body: JSON.stringify({ password }),
+  });
+}
+
+export function readSharedDir(token: string, wd: string): Promise<IFileInfo[]> {
+  return get(`${SERVER_URL}/public/share/${token}/readdir${wd || "/"}`);
+}
+
+export function getSharedFileURL(
+  token: string,
+  filename: string,
+  download = false,
+): URLString {
+  return `${SERVER_URL}/public/share/${token}/file${filename || "/"}${download ? "?download=1" : ""}`;
+}
+
+export function getSharedPreviewURL(token: string, filename: string): URLString {
+  return `${SERVER_URL}/public/share/${token}/preview${filename || "/"}`;
+}
+
+export function getSharedZipURL(token: string, wd: string): URLString {
+  return `${SERVER_URL}/public/share/${token}/zip${wd || "/"}`;
+}
@@ -0,0 +1,12 @@
+import Crudy, { get } from "@allape/gocrud-react";
+import { SERVER_URL } from "@allape/gocrud-react/src/config";
+import IApiToken, { IApiTokenBody, IApiTokenResult } from "../model/token.ts";
+
+export const ApiTokenCrudy = new Crudy<IApiToken>(`${SERVER_URL}/token`);
+
+export function createApiToken(body: IApiTokenBody): Promise<IApiTokenResult> {
+  return get(`${SERVER_URL}/token/create`, {
+    method: "POST",
+    body: JSON.stringify(body),
+  });
+}
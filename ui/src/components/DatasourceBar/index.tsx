@@ -1,10 +1,20 @@
 import { BaseSearchParams } from "@allape/gocrud";
 import { ILV } from "@allape/gocrud-react/src/helper/antd.tsx";
 import { useLoading } from "@allape/use-loading";
-import { Select, Spin } from "antd";
-import { ReactElement, useCallback, useEffect, useState } from "react";
+import { Badge, Select, Spin } from "antd";
+import {
+  ReactElement,
+  ReactNode,
+  useCallback,
+  useEffect,
+  useState,
+} from "react";
 import { DatasourceCrudy } from "../../api/datasource.ts";
-import IDatasource from "../../model/datasource.ts";
+import IDatasource, {
+  HealthBadges,
+  healthTitle,
+  IHealth,
+} from "../../model/datasource.ts";
 import PrimaryDropdown from "../PrimaryDropdown";
 import styles from "./style.module.scss";
 
@@ -21,6 +31,9 @@ export default function DatasourceBar({
 
   const [selected, setSelected] = useState<IDatasource["id"] | undefined>();
   const [options, setOptions] = useState<ILV<IDatasource["id"]>[]>([]);
+  const [healths, setHealths] = useState<
+    Record<IDatasource["id"], IHealth | undefined>
+  >({});
 
   const getSources = useCallback(async () => {
     await execute(async () => {
@@ -33,6 +46,7 @@ export default function DatasourceBar({
           label: d.name,
         })),
       );
+      setHealths(Object.fromEntries(sources.map((d) => [d.id, d.health])));
     });
   }, [execute]);
 
@@ -44,6 +58,18 @@ export default function DatasourceBar({
     setSelected(value);
   }, [value]);
 
+  const renderLabel = useCallback(
+    (id: IDatasource["id"], label: ReactNode): ReactNode => {
+      const health = healths[id];
+      return (
+        <span title={healthTitle(health)}>
+          <Badge status={HealthBadges[health?.status || ""]} /> {label}
+        </span>
+      );
+    },
+    [healths],
+  );
+
   return (
     <Spin spinning={loading}>
       <div className={styles.wrapper}>
@@ -54,6 +80,12 @@ export default function DatasourceBar({
           allowClear
           optionFilterProp="label"
           options={options}
+          optionRender={(option) =>
+            renderLabel(option.value as IDatasource["id"], option.label)
+          }
+          labelRender={(props) =>
+            renderLabel(props.value as IDatasource["id"], props.label)
+          }
           onChange={(v) => {
             setSelected(v);
             onChange?.(v);
@@ -1,6 +1,7 @@
 import { Flex } from "@allape/gocrud-react";
 import { useLoading, useProxy } from "@allape/use-loading";
 import {
+  DownloadOutlined,
   ExportOutlined,
   FullscreenExitOutlined,
   FullscreenOutlined,
@@ -9,7 +10,11 @@ import {
 import { App, Button, Empty, Input, Spin, Tooltip } from "antd";
 import { partial } from "filesize";
 import { ReactElement, useCallback, useEffect, useState } from "react";
-import { getFileURLFromDatasource, readDir } from "../../api/datasource.ts";
+import {
+  getFileURLFromDatasource,
+  getZipURL,
+  readDir,
+} from "../../api/datasource.ts";
 import {
   generatePreview,
   getPreviewURLByDatasource,
@@ -118,7 +123,7 @@ export default function Explorer({
         return;
       }
 
-      if (file.isDir) {
+      if (file.isDir || file.isArchive) {
         // setCwd((cwd) => `${cwd}/${encodeURIComponent(file.name)}`);
         setFiles([]);
         location.hash = `${cwdRef.current}/${encodeURIComponent(file.name)}`;
@@ -218,6 +223,14 @@ export default function Explorer({
             <ReloadOutlined />
           </Button>
           <Button onClick={() => handleGenerate()}>Generate Preview</Button>
+          <Tooltip title="Download this folder as ZIP">
+            <Button
+              disabled={!value}
+              onClick={() => window.open(getZipURL(value!, cwd))}
+            >
+              <DownloadOutlined />
+            </Button>
+          </Tooltip>
         </Flex>
         <div className={styles.files}>
           {cwd && <File name=".." center onClick={() => handleClick("..")} />}
@@ -227,7 +240,7 @@ export default function Explorer({
               name={
                 <div>
                   <div>
-                    {file.isDir ? `📁` : `📃`}
+                    {file.isDir ? `📁` : file.isArchive ? `📦` : `📃`}
                     {" - "}
                     {file.isDir ? "" : `${filesize(file.size)} - `}
                     {new Date(file.mtime).toLocaleString()}
@@ -238,7 +251,11 @@ export default function Explorer({
               }
               alt={file.name}
               cover={file.isDir ? undefined : file.url || IV_404}
-              onClick={file.isDir ? () => handleClick(file) : undefined}
+              onClick={
+                file.isDir || file.isArchive
+                  ? () => handleClick(file)
+                  : undefined
+              }
             >
               {!file.isDir ? (
                 <>
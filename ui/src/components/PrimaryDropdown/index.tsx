@@ -4,6 +4,7 @@ import NewCrudyButtonEventEmitter from "@allape/gocrud-react/src/component/Crudy
 import { DownOutlined } from "@ant-design/icons";
 import {
   Avatar,
+  Badge,
   Button,
   Dropdown,
   Form,
@@ -15,7 +16,12 @@ import {
 import { ReactElement, useMemo, useState } from "react";
 import { DatasourceCrudy } from "../../api/datasource.ts";
 import { getPreviewURLByKey, PreviewCrudy } from "../../api/preview.ts";
-import IDatasource, { DatasourceTypes } from "../../model/datasource.ts";
+import IDatasource, {
+  DatasourceTypes,
+  HealthBadges,
+  healthTitle,
+  IHealth,
+} from "../../model/datasource.ts";
 import IPreview, { IPreviewSearchParams } from "../../model/preview.ts";
 
 export interface IPrimaryDropdownProps {
@@ -88,6 +94,17 @@ export default function PrimaryDropdown({
           return v;
         },
       },
+      {
+        dataIndex: "health",
+        title: "Health",
+        render: (v?: IHealth) => (
+          <Badge
+            status={HealthBadges[v?.status || ""]}
+            text={v?.status ? `${v.status} ${v.latency}ms` : "unknown"}
+            title={healthTitle(v)}
+          />
+        ),
+      },
     ],
     [],
   );
@@ -0,0 +1,27 @@
+import { IBase } from "@allape/gocrud";
+import IDatasource from "./datasource.ts";
+import IUser from "./user.ts";
+
+export const ActionList = 1;
+export const ActionRead = 1 << 1;
+export const ActionGenerate = 1 << 2;
+export const ActionWrite = 1 << 3;
+export const ActionAdmin = 1 << 4;
+
+export interface IGroup extends IBase {
+  name: string;
+  description: string;
+}
+
+export interface IGroupMember extends IBase {
+  groupId: IGroup["id"];
+  userId: IUser["id"];
+}
+
+export interface IPermission extends IBase {
+  datasourceId: IDatasource["id"];
+  path: string;
+  userId: IUser["id"];
+  groupId: IGroup["id"];
+  actions: number;
+}
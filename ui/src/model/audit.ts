@@ -0,0 +1,50 @@
+import { IBase } from "@allape/gocrud";
+import IDatasource from "./datasource.ts";
+import IShare from "./share.ts";
+import IUser from "./user.ts";
+
+export type AuditAction =
+  | "datasource.save"
+  | "datasource.delete"
+  | "preview.generate"
+  | "preview.delete"
+  | "file.serve"
+  | "file.zip"
+  | "file.upload"
+  | "file.mkdir"
+  | "file.rename"
+  | "file.remove"
+  | "share.create"
+  | "share.unlock"
+  | "share.readdir"
+  | "user.save"
+  | "user.delete"
+  | "permission.save"
+  | "permission.delete";
+
+export default interface IAuditEvent extends IBase {
+  action: AuditAction;
+  userId: IUser["id"];
+  username: string;
+  shareId: IShare["id"];
+  datasourceId: IDatasource["id"];
+  path: string;
+  bytes: number;
+  range: string;
+  detail: string;
+  ip: string;
+  userAgent: string;
+}
+
+export interface IAuditSearchParams {
+  action?: AuditAction;
+  in_action?: AuditAction[];
+  userId?: IUser["id"];
+  username?: string;
+  shareId?: IShare["id"];
+  datasourceId?: IDatasource["id"];
+  path?: string;
+  ip?: string;
+  since?: string;
+  until?: string;
+}
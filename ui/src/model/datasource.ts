@@ -1,17 +1,58 @@
 import { IBase } from "@allape/gocrud";
 import { ILV } from "@allape/gocrud-react/src/helper/antd.tsx";
+import { BadgeProps } from "antd";
 
-export type DatasourceType = "dufs" | "local";
+export type DatasourceType = "dufs" | "local" | "sftp" | "webdav" | "s3" | "ftp" | "smb" | "union" | "http-index";
+
+export interface ICredentials {
+  username?: string;
+  password?: string;
+  privateKey?: string;
+  passphrase?: string;
+  token?: string;
+}
+
+export interface ITLSSettings {
+  caCerts: string;
+  clientCert: string;
+  clientKey: string;
+  serverName: string;
+  insecureSkipVerify: boolean;
+}
+
+export type HealthStatus = "ok" | "degraded" | "down";
+
+export interface IHealth {
+  // empty until the first check
+  status: HealthStatus | "";
+  // milliseconds
+  latency: number;
+  error: string;
+  checkedAt?: string;
+}
+
+export interface IConnectivityResult {
+  status: HealthStatus;
+  latency: number;
+  entries: number;
+  error?: string;
+}
 
 export default interface IDatasource extends IBase {
   name: string;
   type: DatasourceType;
   cwd: string;
+  // write only, omit to keep the stored ones, send {} to clear them
+  credentials?: ICredentials;
+  hasCredentials?: boolean;
+  tls?: ITLSSettings;
+  health?: IHealth;
 }
 
 export interface IFileInfo {
   name: string;
   isDir: boolean;
+  isArchive?: boolean;
   size: number;
   mtime: number;
   hasPreview: boolean;
@@ -26,4 +67,52 @@ export const DatasourceTypes: ILV<DatasourceType>[] = [
     value: "local",
     label: "Local",
   },
+  {
+    value: "sftp",
+    label: "SFTP",
+  },
+  {
+    value: "webdav",
+    label: "WebDAV",
+  },
+  {
+    value: "s3",
+    label: "S3",
+  },
+  {
+    value: "ftp",
+    label: "FTP",
+  },
+  {
+    value: "smb",
+    label: "SMB",
+  },
+  {
+    value: "union",
+    label: "Union",
+  },
+  {
+    value: "http-index",
+    label: "HTTP Index",
+  },
 ];
+
+export const HealthBadges: Record<IHealth["status"], BadgeProps["status"]> = {
+  "": "default",
+  ok: "success",
+  degraded: "warning",
+  down: "error",
+};
+
+export function healthTitle(health?: IHealth): string {
+  if (!health?.checkedAt) {
+    return "Not checked yet";
+  }
+  const checkedAt = new Date(health.checkedAt).toLocaleString();
+  return [
+    `${health.status}, ${health.latency}ms at ${checkedAt}`,
+    health.error,
+  ]
+    .filter(Boolean)
+    .join("\n");
+}
@@ -2,12 +2,44 @@ import { IBase } from "@allape/gocrud";
 import { IBaseSearchParams } from "@allape/gocrud/src/model.ts";
 import IDatasource from "./datasource.ts";
 
+export interface ISubtitle {
+  index: number;
+  file?: string;
+  codec: string;
+  language: string;
+  title: string;
+  default: boolean;
+  forced: boolean;
+}
+
+export interface IChapter {
+  start: number;
+  end: number;
+  title: string;
+}
+
+export interface IAudioTrack {
+  index: number;
+  codec: string;
+  language: string;
+  title: string;
+  channels: number;
+  channelLayout: string;
+  sampleRate: number;
+  default: boolean;
+}
+
 export default interface IPreview extends IBase {
   datasourceId: string;
   key: string;
   digest: string;
   cover: string;
   ffprobeInfo: string;
+  poster: string;
+  posterAt: number;
+  subtitles: ISubtitle[] | null;
+  chapters: IChapter[] | null;
+  audioTracks: IAudioTrack[] | null;
 }
 
 export interface IPreviewSearchParams extends IBaseSearchParams {
@@ -0,0 +1,37 @@
+import { IBase } from "@allape/gocrud";
+import IDatasource from "./datasource.ts";
+import IUser from "./user.ts";
+
+export type ShareScope = "preview" | "download";
+
+export default interface IShare extends IBase {
+  datasourceId: IDatasource["id"];
+  path: string;
+  isDir: boolean;
+  scope: ShareScope;
+  protected: boolean;
+  expiresAt?: string;
+  maxDownloads: number;
+  downloads: number;
+  createdBy: IUser["id"];
+}
+
+export interface IShareBody {
+  scope: ShareScope;
+  password?: string;
+  expiresInHours?: number;
+  maxDownloads?: number;
+}
+
+export interface IShareResult {
+  token: string;
+  share: IShare;
+}
+
+export interface IShareInfo {
+  name: string;
+  isDir: boolean;
+  scope: ShareScope;
+  protected: boolean;
+  expiresAt?: string;
+}
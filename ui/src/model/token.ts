@@ -0,0 +1,24 @@
+import { IBase } from "@allape/gocrud";
+import IUser from "./user.ts";
+
+export type TokenScope = "read" | "generate" | "admin";
+
+export default interface IApiToken extends IBase {
+  name: string;
+  userId: IUser["id"];
+  scopes: TokenScope[];
+  expiresAt?: string;
+  lastUsedAt?: string;
+  lastUsedIp: string;
+}
+
+export interface IApiTokenBody {
+  name: string;
+  scopes: TokenScope[];
+  expiresInHours?: number;
+}
+
+export interface IApiTokenResult {
+  token: string;
+  apiToken: IApiToken;
+}
@@ -0,0 +1,14 @@
+import { IBase } from "@allape/gocrud";
+
+export default interface IUser extends IBase {
+  username: string;
+  password?: string;
+  admin: boolean;
+  disabled: boolean;
+}
+
+export interface ILoginResult {
+  token: string;
+  expiresAt: string;
+  user: IUser;
+}
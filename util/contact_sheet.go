@@ -0,0 +1,239 @@
+package util
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allape/goview/assets"
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+)
+
+var (
+	sheetBackground    = color.RGBA{R: 0x20, G: 0x20, B: 0x20, A: 0xff}
+	sheetText          = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	sheetSecondaryText = color.RGBA{R: 0xc0, G: 0xc0, B: 0xc0, A: 0xff}
+	timecodeBackground = color.RGBA{A: 0xa0}
+)
+
+func FormatTimecode(d time.Duration) string {
+	seconds := int64(d.Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	exp := int(math.Log(float64(size)) / math.Log(unit))
+	if exp > 6 {
+		exp = 6
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(size)/math.Pow(unit, float64(exp)), "KMGTPE"[exp-1])
+}
+
+// headerLines returns the media info lines printed in the header band of a contact sheet
+func (f *FFProbeJson) headerLines(filename string) []string {
+	duration, _ := f.Duration()
+	size := f.Size()
+	fileSize, _ := strconv.ParseInt(f.Format.Size, 10, 64)
+
+	var videoCodecs, audioCodecs []string
+	for _, stream := range f.Streams {
+		codec := stream.CodecName
+		if stream.Profile != "" {
+			codec = fmt.Sprintf("%s (%s)", codec, stream.Profile)
+		}
+		switch stream.CodecType {
+		case Video:
+			videoCodecs = append(videoCodecs, codec)
+		case Audio:
+			audioCodecs = append(audioCodecs, codec)
+		}
+	}
+
+	return []string{
+		filename,
+		fmt.Sprintf(
+			"Duration: %s  |  Resolution: %dx%d  |  Size: %s",
+			FormatTimecode(duration), size.X, size.Y, FormatBytes(fileSize),
+		),
+		fmt.Sprintf(
+			"Video: %s  |  Audio: %s  |  Format: %s",
+			strings.Join(videoCodecs, ", "), strings.Join(audioCodecs, ", "), f.Format.FormatName,
+		),
+	}
+}
+
+var showinfoPattern = regexp.MustCompile(`\bn:\s*(\d+)\s.*\bpts_time:(-?[\d.]+)`)
+
+// showinfoTimes reads the timestamps of frames printed by the showinfo filter in ffmpeg output,
+// relative to start, in the order of frames
+func showinfoTimes(output []byte, start time.Duration) []time.Duration {
+	var times []time.Duration
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.Contains(line, "showinfo") {
+			continue
+		}
+		match := showinfoPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n != len(times) {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		at := time.Duration(seconds*float64(time.Second)) - start
+		if at < 0 {
+			at = 0
+		}
+		times = append(times, at)
+	}
+	return times
+}
+
+func loadJPEG(file string) (image.Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return jpeg.Decode(f)
+}
+
+// FFMpegVideoContactSheet
+// same sampling as FFMpegVideoSampleImage,
+// but each tile is labeled with its timecode, and a header band with media info is drawn on top
+func FFMpegVideoContactSheet(video, image, filename string, scale float64, tile image.Point) (CommandOutput, error) {
+	ffprobe, err := FFProbe(video)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := ffprobe.Duration()
+	if err != nil {
+		return nil, err
+	}
+
+	size := ffprobe.Size()
+	count := tile.X * tile.Y
+	interval := duration / time.Duration(count)
+	tileWidth, tileHeight := int(float64(size.X)*scale), int(float64(size.Y)*scale)
+
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "goview_sheet_*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	cmd := exec.Command(
+		"ffmpeg",
+		"-y",
+		"-hide_banner",
+		"-i",
+		video,
+		"-fps_mode",
+		"vfr",
+		"-vf",
+		fmt.Sprintf(
+			"select='isnan(prev_selected_t)+gte(t-prev_selected_t\\,%.02f)',showinfo,scale=%d:%d",
+			interval.Seconds(),
+			tileWidth,
+			tileHeight,
+		),
+		"-frames:v",
+		strconv.Itoa(count),
+		path.Join(tmpDir, "%04d.jpg"),
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("ffmpeg: %w: %s", err, output)
+	}
+
+	// the selected frames land on whatever frame comes first after each interval, label them with their own time
+	startSeconds, _ := strconv.ParseFloat(ffprobe.Format.StartTime, 64)
+	times := showinfoTimes(output, time.Duration(startSeconds*float64(time.Second)))
+
+	font, err := assets.LoadFont()
+	if err != nil {
+		return output, err
+	}
+
+	sheetWidth := tileWidth * tile.X
+	headerFontSize := math.Max(12, float64(sheetWidth)/80)
+	headerLineHeight := headerFontSize * 1.5
+	headerHeight := int(headerLineHeight*3 + headerFontSize)
+	tileFontSize := math.Max(10, float64(tileHeight)/10)
+
+	dc := gg.NewContext(sheetWidth, headerHeight+tileHeight*tile.Y)
+	dc.SetColor(sheetBackground)
+	dc.Clear()
+
+	for i, line := range ffprobe.headerLines(filename) {
+		if i == 0 {
+			dc.SetColor(sheetText)
+		} else {
+			dc.SetColor(sheetSecondaryText)
+		}
+		dc.SetFontFace(truetype.NewFace(font, &truetype.Options{Size: headerFontSize}))
+		dc.DrawStringAnchored(line, headerFontSize/2, headerFontSize/2+headerLineHeight*float64(i), 0, 1)
+	}
+
+	dc.SetFontFace(truetype.NewFace(font, &truetype.Options{Size: tileFontSize}))
+	for i := 0; i < count; i++ {
+		frame, err := loadJPEG(path.Join(tmpDir, fmt.Sprintf("%04d.jpg", i+1)))
+		if err != nil {
+			// short videos may have fewer frames than tiles
+			break
+		}
+
+		x := (i % tile.X) * tileWidth
+		y := headerHeight + (i/tile.X)*tileHeight
+		dc.DrawImage(frame, x, y)
+
+		at := interval * time.Duration(i)
+		if i < len(times) {
+			at = times[i]
+		}
+		timecode := FormatTimecode(at)
+		textWidth, textHeight := dc.MeasureString(timecode)
+		padding := tileFontSize / 4
+		right, bottom := float64(x+tileWidth)-padding, float64(y+tileHeight)-padding
+
+		dc.SetColor(timecodeBackground)
+		dc.DrawRectangle(right-textWidth-padding*2, bottom-textHeight-padding*2, textWidth+padding*2, textHeight+padding*2)
+		dc.Fill()
+
+		dc.SetColor(sheetText)
+		dc.DrawStringAnchored(timecode, right-padding, bottom-padding, 1, 0)
+	}
+
+	file, err := os.Create(image)
+	if err != nil {
+		return output, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return output, jpeg.Encode(file, dc.Image(), &jpeg.Options{Quality: 85})
+}
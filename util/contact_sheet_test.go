@@ -0,0 +1,71 @@
+package util
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFormatTimecode(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		0:                      "00:00:00",
+		999 * time.Millisecond: "00:00:00",
+		61 * time.Second:       "00:01:01",
+		7384 * time.Second:     "02:03:04",
+		101 * time.Hour:        "101:00:00",
+	} {
+		if actual := FormatTimecode(d); actual != expected {
+			t.Errorf("FormatTimecode(%s) = %s, expected %s", d, actual, expected)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for size, expected := range map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.00 KiB",
+		1536:            "1.50 KiB",
+		5 * 1024 * 1024: "5.00 MiB",
+		3 << 40:         "3.00 TiB",
+	} {
+		if actual := FormatBytes(size); actual != expected {
+			t.Errorf("FormatBytes(%d) = %s, expected %s", size, actual, expected)
+		}
+	}
+}
+
+func TestHeaderLines(t *testing.T) {
+	ffprobe := &FFProbeJson{
+		Streams: []FFProbeStream{
+			{CodecType: Video, CodecName: "h264", Profile: "High", Width: 1920, Height: 1080},
+			{CodecType: Audio, CodecName: "aac", Profile: "LC"},
+			{CodecType: Audio, CodecName: "ac3"},
+		},
+		Format: FFProbeFormat{Duration: "3725.5", Size: "1073741824", FormatName: "mov,mp4"},
+	}
+
+	expected := []string{
+		"movie.mp4",
+		"Duration: 01:02:05  |  Resolution: 1920x1080  |  Size: 1.00 GiB",
+		"Video: h264 (High)  |  Audio: aac (LC), ac3  |  Format: mov,mp4",
+	}
+	if actual := ffprobe.headerLines("movie.mp4"); !slices.Equal(actual, expected) {
+		t.Errorf("unexpected header lines %q", actual)
+	}
+}
+
+func TestShowinfoTimes(t *testing.T) {
+	output := []byte(`Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'movie.mp4':
+[Parsed_showinfo_1 @ 0x5581] config in time_base: 1/12800, frame_rate: 25/1
+[Parsed_showinfo_1 @ 0x5581] n:   0 pts:  17920 pts_time:1.4     duration:    512 duration_time:0.04
+[Parsed_showinfo_1 @ 0x5581] n:   1 pts: 146432 pts_time:11.44   duration:    512 duration_time:0.04
+[Parsed_showinfo_1 @ 0x5581] n:   2 pts: 274944 pts_time:21.48   duration:    512 duration_time:0.04
+frame=    3 fps=0.0 q=2.0 Lsize=N/A time=00:00:21.48 bitrate=N/A speed= 60x`)
+
+	times := showinfoTimes(output, 1400*time.Millisecond)
+	expected := []time.Duration{0, 10040 * time.Millisecond, 20080 * time.Millisecond}
+	if !slices.Equal(times, expected) {
+		t.Errorf("unexpected times %v", times)
+	}
+}
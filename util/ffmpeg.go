@@ -6,7 +6,9 @@ import (
 	"image"
 	"os"
 	"os/exec"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,8 +17,9 @@ type CommandOutput []byte
 type CodecType string
 
 const (
-	Video CodecType = "video"
-	Audio CodecType = "audio"
+	Video    CodecType = "video"
+	Audio    CodecType = "audio"
+	Subtitle CodecType = "subtitle"
 )
 
 type FFProbeStream struct {
@@ -30,6 +33,24 @@ type FFProbeStream struct {
 	NbFrames      string    `json:"nb_frames"`
 	Width         int       `json:"width"`
 	Height        int       `json:"height"`
+	SampleRate    string    `json:"sample_rate"`
+	Channels      int       `json:"channels"`
+	ChannelLayout string    `json:"channel_layout"`
+
+	Disposition map[string]int    `json:"disposition"`
+	Tags        map[string]string `json:"tags"`
+}
+
+func (s *FFProbeStream) IsDefault() bool {
+	return s.Disposition["default"] == 1
+}
+
+func (s *FFProbeStream) Language() string {
+	return s.Tags["language"]
+}
+
+func (s *FFProbeStream) Title() string {
+	return s.Tags["title"]
 }
 
 type FFProbeFormat struct {
@@ -47,9 +68,24 @@ type FFProbeFormat struct {
 	Tags           any    `json:"tags"`
 }
 
+type FFProbeChapter struct {
+	ID        int64             `json:"id"`
+	TimeBase  string            `json:"time_base"`
+	Start     int64             `json:"start"`
+	StartTime string            `json:"start_time"`
+	End       int64             `json:"end"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+func (c *FFProbeChapter) Title() string {
+	return c.Tags["title"]
+}
+
 type FFProbeJson struct {
-	Streams []FFProbeStream `json:"streams"`
-	Format  FFProbeFormat   `json:"format"`
+	Streams  []FFProbeStream  `json:"streams"`
+	Chapters []FFProbeChapter `json:"chapters"`
+	Format   FFProbeFormat    `json:"format"`
 }
 
 func (f *FFProbeJson) NBFrames(ct CodecType) (uint64, error) {
@@ -96,6 +132,7 @@ func FFProbe(file string) (*FFProbeJson, error) {
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
+		"-show_chapters",
 		file,
 	)
 	output, err := cmd.CombinedOutput()
@@ -207,3 +244,81 @@ func ExifToolPreview(dst, src string) error {
 
 	return nil
 }
+
+type ImageFit string
+
+const (
+	FitContain ImageFit = "contain"
+	FitCover   ImageFit = "cover"
+	FitFill    ImageFit = "fill"
+)
+
+// FFMpegResizeImage
+// output format is determined by the extension of dst,
+// width or height can be 0 to keep the aspect ratio, quality ranges from 1 to 100
+func FFMpegResizeImage(dst, src string, width, height int, fit ImageFit, quality int) (CommandOutput, error) {
+	args := []string{
+		"-y",
+		"-hide_banner",
+		"-i",
+		src,
+	}
+
+	var filter string
+	switch {
+	case width > 0 && height > 0:
+		switch fit {
+		case FitCover:
+			filter = fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", width, height, width, height)
+		case FitFill:
+			filter = fmt.Sprintf("scale=%d:%d", width, height)
+		default:
+			filter = fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", width, height)
+		}
+	case width > 0:
+		filter = fmt.Sprintf("scale=%d:-1", width)
+	case height > 0:
+		filter = fmt.Sprintf("scale=-1:%d", height)
+	}
+	if filter != "" {
+		args = append(args, "-vf", filter)
+	}
+
+	switch strings.ToLower(path.Ext(dst)) {
+	case ".jpg", ".jpeg":
+		// map 1~100 to 31~2
+		args = append(args, "-q:v", strconv.Itoa(31-(quality-1)*29/99))
+	case ".webp":
+		args = append(args, "-quality", strconv.Itoa(quality))
+	}
+
+	args = append(args, "-frames:v", "1", dst)
+
+	cmd := exec.Command("ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("ffmpeg: %w: %s", err, output)
+	}
+	return output, nil
+}
+
+// FFMpegSubtitleToWebVTT converts the subtitle stream at index of src into WebVTT
+func FFMpegSubtitleToWebVTT(dst, src string, index int) (CommandOutput, error) {
+	cmd := exec.Command(
+		"ffmpeg",
+		"-y",
+		"-hide_banner",
+		"-i",
+		src,
+		"-map",
+		fmt.Sprintf("0:%d", index),
+		"-f",
+		"webvtt",
+		dst,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("ffmpeg: %w: %s", err, output)
+	}
+	return output, nil
+}
@@ -0,0 +1,209 @@
+package util
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"time"
+)
+
+const (
+	DarkFrameThreshold   = 0.08
+	BrightFrameThreshold = 0.95
+	sharpnessHalfPoint   = 100
+)
+
+type FrameScore struct {
+	Brightness float64 // mean luminance, 0 ~ 1
+	Entropy    float64 // luminance histogram entropy, 0 ~ 1
+	Sharpness  float64 // variance of laplacian mapped into 0 ~ 1
+	Score      float64
+}
+
+func luminance(img image.Image) ([][]float64, int, int) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	lum := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		lum[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			lum[y][x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff * 255
+		}
+	}
+
+	return lum, width, height
+}
+
+// ScoreFrame rates how good a frame is as a poster,
+// black, blank and blurry frames get lower scores
+func ScoreFrame(img image.Image) FrameScore {
+	lum, width, height := luminance(img)
+	if width == 0 || height == 0 {
+		return FrameScore{}
+	}
+
+	var histogram [256]int
+	sum := 0.0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sum += lum[y][x]
+			histogram[int(math.Min(255, math.Round(lum[y][x])))]++
+		}
+	}
+
+	total := float64(width * height)
+	brightness := sum / total / 255
+
+	entropy := 0.0
+	for _, count := range histogram {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / total
+		entropy -= p * math.Log2(p)
+	}
+	entropy /= 8
+
+	sharpness := 0.0
+	if width > 2 && height > 2 {
+		var values []float64
+		mean := 0.0
+		for y := 1; y < height-1; y++ {
+			for x := 1; x < width-1; x++ {
+				v := lum[y-1][x] + lum[y+1][x] + lum[y][x-1] + lum[y][x+1] - 4*lum[y][x]
+				values = append(values, v)
+				mean += v
+			}
+		}
+		mean /= float64(len(values))
+		variance := 0.0
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(len(values))
+		sharpness = variance / (variance + sharpnessHalfPoint)
+	}
+
+	score := 0.45*entropy + 0.35*sharpness + 0.2*(1-math.Abs(brightness-0.5)*2)
+	if brightness < DarkFrameThreshold || brightness > BrightFrameThreshold {
+		score *= 0.1
+	}
+
+	return FrameScore{
+		Brightness: brightness,
+		Entropy:    entropy,
+		Sharpness:  sharpness,
+		Score:      score,
+	}
+}
+
+// FFMpegExtractFrame extracts a single frame at the given time, width <= 0 keeps the original size
+func FFMpegExtractFrame(video, image string, at time.Duration, width int) (CommandOutput, error) {
+	args := []string{
+		"-y",
+		"-hide_banner",
+		"-ss",
+		fmt.Sprintf("%.03f", at.Seconds()),
+		"-i",
+		video,
+	}
+	if width > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", width))
+	}
+	args = append(args, "-frames:v", "1", image)
+
+	cmd := exec.Command("ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("ffmpeg: %w: %s", err, output)
+	}
+	return output, nil
+}
+
+func scoreFrameFile(file string) (FrameScore, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return FrameScore{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		return FrameScore{}, err
+	}
+
+	return ScoreFrame(img), nil
+}
+
+// FFMpegVideoPoster samples candidates frames evenly across the video,
+// and saves the best scored one into image, returns the timestamp of the chosen frame
+func FFMpegVideoPoster(video, image string, candidates int, scale float64) (time.Duration, error) {
+	ffprobe, err := FFProbe(video)
+	if err != nil {
+		return 0, err
+	}
+
+	duration, err := ffprobe.Duration()
+	if err != nil {
+		return 0, err
+	}
+
+	if candidates <= 0 {
+		candidates = 1
+	}
+
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "goview_poster_*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	bestAt := time.Duration(-1)
+	bestScore := -1.0
+
+	var lastErr error
+
+	for i := 0; i < candidates; i++ {
+		at := time.Duration(float64(duration) * (float64(i) + 0.5) / float64(candidates))
+
+		// scoring on small frames is much faster, and good enough
+		sample := path.Join(tmpDir, fmt.Sprintf("%d.jpg", i))
+		_, err = FFMpegExtractFrame(video, sample, at, 320)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		score, err := scoreFrameFile(sample)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if score.Score > bestScore {
+			bestScore = score.Score
+			bestAt = at
+		}
+	}
+
+	if bestAt < 0 {
+		return 0, fmt.Errorf("no frame could be extracted from %s: %w", video, lastErr)
+	}
+
+	_, err = FFMpegExtractFrame(video, image, bestAt, int(float64(ffprobe.Size().X)*scale))
+	if err != nil {
+		return 0, err
+	}
+
+	return bestAt, nil
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func newFrame(fill func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{Y: fill(x, y)})
+		}
+	}
+	return img
+}
+
+func TestScoreFrame(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	black := ScoreFrame(newFrame(func(x, y int) uint8 { return 2 }))
+	white := ScoreFrame(newFrame(func(x, y int) uint8 { return 254 }))
+	blurry := ScoreFrame(newFrame(func(x, y int) uint8 { return uint8(64 + x*2) }))
+	detailed := ScoreFrame(newFrame(func(x, y int) uint8 { return uint8(random.Intn(256)) }))
+
+	if black.Brightness >= DarkFrameThreshold {
+		t.Errorf("expected black frame to be dark, got brightness %f", black.Brightness)
+	}
+	if white.Brightness <= BrightFrameThreshold {
+		t.Errorf("expected white frame to be blank, got brightness %f", white.Brightness)
+	}
+	if blurry.Sharpness >= detailed.Sharpness {
+		t.Errorf("expected gradient to be blurrier than noise, got %f >= %f", blurry.Sharpness, detailed.Sharpness)
+	}
+
+	for name, score := range map[string]FrameScore{"black": black, "white": white, "blurry": blurry} {
+		if score.Score >= detailed.Score {
+			t.Errorf("expected %s frame to score lower than detailed frame, got %f >= %f", name, score.Score, detailed.Score)
+		}
+	}
+}
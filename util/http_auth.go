@@ -0,0 +1,178 @@
+package util
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type DigestChallenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	Qop       string
+}
+
+// ParseDigestChallenge parses the value of a WWW-Authenticate header starting with "Digest "
+func ParseDigestChallenge(header string) (*DigestChallenge, bool) {
+	scheme, params, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Digest") {
+		return nil, false
+	}
+
+	values := map[string]string{}
+	for len(params) > 0 {
+		params = strings.TrimLeft(params, " ,")
+		key, rest, found := strings.Cut(params, "=")
+		if !found {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, params = rest[1:end+1], rest[end+2:]
+		} else {
+			value, params, _ = strings.Cut(rest, ",")
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+
+	challenge := &DigestChallenge{
+		Realm:     values["realm"],
+		Nonce:     values["nonce"],
+		Opaque:    values["opaque"],
+		Algorithm: values["algorithm"],
+	}
+
+	for _, qop := range strings.Split(values["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			challenge.Qop = "auth"
+		}
+	}
+
+	return challenge, challenge.Nonce != ""
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Response calculates the digest response defined in RFC 2617, only MD5 is supported
+func (c *DigestChallenge) Response(username, password, method, uri, nc, cnonce string) string {
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", username, c.Realm, password))
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", method, uri))
+	if c.Qop == "" {
+		return md5Hex(fmt.Sprintf("%s:%s:%s", ha1, c.Nonce, ha2))
+	}
+	return md5Hex(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, c.Nonce, nc, cnonce, c.Qop, ha2))
+}
+
+func (c *DigestChallenge) Authorization(username, password, method, uri string, count uint32) string {
+	nc := fmt.Sprintf("%08x", count)
+
+	cnonce := make([]byte, 8)
+	_, _ = rand.Read(cnonce)
+	cnonceHex := hex.EncodeToString(cnonce)
+
+	header := fmt.Sprintf(
+		`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, c.Realm, c.Nonce, uri, c.Response(username, password, method, uri, nc, cnonceHex),
+	)
+	if c.Algorithm != "" {
+		header += fmt.Sprintf(", algorithm=%s", c.Algorithm)
+	}
+	if c.Opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, c.Opaque)
+	}
+	if c.Qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, c.Qop, nc, cnonceHex)
+	}
+	return header
+}
+
+// AuthTransport sends basic auth by default, and switches to digest auth once the server asks for it
+type AuthTransport struct {
+	Username  string
+	Password  string
+	Transport http.RoundTripper
+
+	locker    sync.Mutex
+	challenge *DigestChallenge
+	count     uint32
+}
+
+func (t *AuthTransport) base() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+func (t *AuthTransport) authorize(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	if t.challenge == nil {
+		req.SetBasicAuth(t.Username, t.Password)
+	} else {
+		t.count++
+		req.Header.Set("Authorization", t.challenge.Authorization(t.Username, t.Password, req.Method, req.URL.RequestURI(), t.count))
+	}
+
+	return req
+}
+
+func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Username == "" && t.Password == "" {
+		return t.base().RoundTrip(req)
+	}
+
+	resp, err := t.base().RoundTrip(t.authorize(req))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// servers offering several schemes send one header for each
+	var challenge *DigestChallenge
+	for _, header := range resp.Header.Values("WWW-Authenticate") {
+		if parsed, ok := ParseDigestChallenge(header); ok {
+			challenge = parsed
+			break
+		}
+	}
+	if challenge == nil || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+
+	_ = resp.Body.Close()
+
+	t.locker.Lock()
+	t.challenge = challenge
+	t.count = 0
+	t.locker.Unlock()
+
+	retry := req
+	if req.Body != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry = req.Clone(req.Context())
+		retry.Body = body
+	}
+
+	return t.base().RoundTrip(t.authorize(retry))
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDigestChallengeResponse(t *testing.T) {
+	// example from RFC 2617 section 3.5
+	challenge, ok := ParseDigestChallenge(`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+	if !ok {
+		t.Fatal("failed to parse challenge")
+	}
+
+	if challenge.Realm != "testrealm@host.com" || challenge.Qop != "auth" || challenge.Opaque != "5ccc069c403ebaf9f0171e9517f40e41" {
+		t.Fatalf("unexpected challenge %+v", challenge)
+	}
+
+	response := challenge.Response("Mufasa", "Circle Of Life", "GET", "/dir/index.html", "00000001", "0a4f113b")
+	if response != "6629fae49393a05397450978507c4ef1" {
+		t.Errorf("unexpected response %s", response)
+	}
+}
+
+func TestAuthTransportMultipleChallenges(t *testing.T) {
+	var challenged atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !strings.HasPrefix(request.Header.Get("Authorization"), "Digest ") {
+			challenged.Add(1)
+			writer.Header().Add("WWW-Authenticate", `Basic realm="goview"`)
+			writer.Header().Add("WWW-Authenticate", `Digest realm="goview", qop="auth", nonce="abc"`)
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &AuthTransport{Username: "goview", Password: "secret"}}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: expected digest auth to be used, got %s", i, resp.Status)
+		}
+	}
+
+	if n := challenged.Load(); n != 1 {
+		t.Errorf("expected the digest challenge to be remembered, challenged %d times", n)
+	}
+}